@@ -0,0 +1,262 @@
+// Package addrbook manages an address book of packet stations, used to resolve
+// the names that operators put in message headers (tactical calls, FCC calls,
+// ICS positions, aliases, and distribution lists) into fully qualified BBS
+// addresses, and to translate incoming addresses back into recognizable
+// names.
+//
+// An address book is stored as a CSV file.  Each row describes either a
+// station or a distribution list:
+//
+//	station,«tactical»,«fcc»,«bbs»,«position»,«name»,«alias»...
+//	list,«name»,«member»...
+//
+// For a station, any of the fields may be empty except that at least one of
+// the tactical and FCC calls must be given.  The «bbs» is the home BBS of the
+// station (e.g. "W6XSC"); if it is empty, the address book's default BBS is
+// used.  The members of a list may be any names the address book can resolve,
+// including other lists.
+package addrbook
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rothskeller/packet/envelope"
+)
+
+// A Station is an address book entry describing one packet station.
+type Station struct {
+	// Tactical is the tactical call sign of the station (e.g. "XNDEOC").
+	// It is the preferred mailbox name for the station if present.
+	Tactical string
+	// FCC is the FCC call sign of the station (e.g. "KC6RSC").  It is the
+	// mailbox name for the station if there is no tactical call sign.
+	FCC string
+	// BBS is the home BBS of the station, without domain (e.g. "W6XSC").
+	BBS string
+	// Position is the ICS position staffed at the station (e.g. "Planning
+	// Section Chief").
+	Position string
+	// Name is the display name for the station.  If it is empty, the
+	// Position is used as the display name.
+	Name string
+	// Aliases are additional names by which the station can be addressed.
+	Aliases []string
+}
+
+// A List is an address book entry describing a distribution list.
+type List struct {
+	// Name is the name of the list.
+	Name string
+	// Members are the names of the members of the list.  They may be any
+	// names that the address book can resolve, including other lists.
+	Members []string
+}
+
+// A Book is an address book.
+type Book struct {
+	// DefaultBBS is the BBS used for stations whose home BBS is not
+	// specified, and for bare mailbox names not found in the address book.
+	// If it is empty, such names are left unqualified.
+	DefaultBBS string
+	stations   []*Station
+	lists      []*List
+}
+
+// ErrLoop is returned when a distribution list includes itself, directly or
+// indirectly.
+var ErrLoop = errors.New("distribution list includes itself")
+
+// New returns a new, empty address book.
+func New(defaultBBS string) *Book {
+	return &Book{DefaultBBS: defaultBBS}
+}
+
+// AddStation adds a station to the address book.
+func (b *Book) AddStation(s *Station) {
+	b.stations = append(b.stations, s)
+}
+
+// AddList adds a distribution list to the address book.
+func (b *Book) AddList(l *List) {
+	b.lists = append(b.lists, l)
+}
+
+// Stations returns the stations in the address book.
+func (b *Book) Stations() []*Station { return b.stations }
+
+// Lists returns the distribution lists in the address book.
+func (b *Book) Lists() []*List { return b.lists }
+
+// Load reads an address book from the named CSV file.
+func Load(filename, defaultBBS string) (b *Book, err error) {
+	var fh *os.File
+
+	if fh, err = os.Open(filename); err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	if b, err = Read(fh, defaultBBS); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return b, nil
+}
+
+// Read reads an address book in CSV format from the supplied reader.
+func Read(r io.Reader, defaultBBS string) (b *Book, err error) {
+	var cr = csv.NewReader(r)
+
+	b = New(defaultBBS)
+	cr.FieldsPerRecord = -1
+	cr.Comment = '#'
+	for {
+		var row []string
+
+		if row, err = cr.Read(); err == io.EOF {
+			return b, nil
+		} else if err != nil {
+			return nil, err
+		}
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+		switch strings.ToLower(row[0]) {
+		case "station":
+			var s Station
+			row = append(row, "", "", "", "", "", "")
+			s.Tactical, s.FCC, s.BBS, s.Position, s.Name = row[1], row[2], row[3], row[4], row[5]
+			for _, alias := range row[6:] {
+				if alias != "" {
+					s.Aliases = append(s.Aliases, alias)
+				}
+			}
+			if s.Tactical == "" && s.FCC == "" {
+				line, _ := cr.FieldPos(0)
+				return nil, fmt.Errorf("line %d: station has no call sign", line)
+			}
+			b.AddStation(&s)
+		case "list":
+			var l List
+			if len(row) < 2 || row[1] == "" {
+				line, _ := cr.FieldPos(0)
+				return nil, fmt.Errorf("line %d: list has no name", line)
+			}
+			l.Name = row[1]
+			for _, member := range row[2:] {
+				if member != "" {
+					l.Members = append(l.Members, member)
+				}
+			}
+			b.AddList(&l)
+		default:
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("line %d: unknown entry type %q", line, row[0])
+		}
+	}
+}
+
+// Save writes the address book to the named file in CSV format.
+func (b *Book) Save(filename string) (err error) {
+	var fh *os.File
+
+	if fh, err = os.Create(filename); err != nil {
+		return err
+	}
+	if err = b.Write(fh); err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+// Write writes the address book in CSV format to the supplied writer.
+func (b *Book) Write(w io.Writer) error {
+	var cw = csv.NewWriter(w)
+
+	for _, s := range b.stations {
+		cw.Write(append([]string{"station", s.Tactical, s.FCC, s.BBS, s.Position, s.Name}, s.Aliases...))
+	}
+	for _, l := range b.lists {
+		cw.Write(append([]string{"list", l.Name}, l.Members...))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// Mailbox returns the mailbox name of the station:  its tactical call sign if
+// it has one, otherwise its FCC call sign.
+func (s *Station) Mailbox() string {
+	if s.Tactical != "" {
+		return s.Tactical
+	}
+	return s.FCC
+}
+
+// DisplayName returns the display name of the station:  its Name if it has
+// one, otherwise its Position.
+func (s *Station) DisplayName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Position
+}
+
+// matches returns whether the station is known by the specified name.
+func (s *Station) matches(name string) bool {
+	if strings.EqualFold(name, s.Tactical) || strings.EqualFold(name, s.FCC) || strings.EqualFold(name, s.Position) {
+		return name != ""
+	}
+	for _, alias := range s.Aliases {
+		if strings.EqualFold(name, alias) {
+			return true
+		}
+	}
+	return false
+}
+
+// Lookup returns the station known by the specified name (tactical call, FCC
+// call, ICS position, or alias), or nil if there is none.  The match is case
+// insensitive.
+func (b *Book) Lookup(name string) *Station {
+	for _, s := range b.stations {
+		if s.matches(name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// LookupList returns the distribution list with the specified name, or nil if
+// there is none.  The match is case insensitive.
+func (b *Book) LookupList(name string) *List {
+	for _, l := range b.lists {
+		if strings.EqualFold(name, l.Name) {
+			return l
+		}
+	}
+	return nil
+}
+
+// Address returns the fully qualified address of the station, including its
+// display name.
+func (b *Book) Address(s *Station) *envelope.Address {
+	var bbs = s.BBS
+
+	if bbs == "" {
+		bbs = b.DefaultBBS
+	}
+	return &envelope.Address{Name: s.DisplayName(), Address: qualify(s.Mailbox(), bbs)}
+}
+
+// qualify returns the fully qualified address for the specified mailbox at the
+// specified BBS.  If the BBS is empty, the mailbox is returned unchanged.
+func qualify(mailbox, bbs string) string {
+	if bbs == "" {
+		return mailbox
+	}
+	return strings.ToUpper(mailbox) + "@" + strings.ToLower(bbs) + ".ampr.org"
+}
@@ -0,0 +1,65 @@
+package addrbook
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/rothskeller/packet/envelope"
+)
+
+const testBook = `# test address book
+station,XNDEOC,KC6RSC,W6XSC,Planning Section Chief,,planning
+station,XSCEOC,,W2XSC,,County EOC,county
+station,,KK6XYZ,,,Joe Operator
+list,EOCs,XNDEOC,county
+list,Everyone,EOCs,kk6xyz,nobody@example.com
+list,Loop,Loop2
+list,Loop2,Loop
+`
+
+func TestExpand(t *testing.T) {
+	book, err := Read(strings.NewReader(testBook), "W4XSC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ in, out string }{
+		{"xndeoc", "Planning Section Chief <XNDEOC@w6xsc.ampr.org>"},
+		{"Planning Section Chief", "Planning Section Chief <XNDEOC@w6xsc.ampr.org>"},
+		{"County", "County EOC <XSCEOC@w2xsc.ampr.org>"},
+		{"Boss <planning>", "Boss <XNDEOC@w6xsc.ampr.org>"},
+		{"kk6xyz, XSCBBS", "Joe Operator <KK6XYZ@w4xsc.ampr.org>, XSCBBS@w4xsc.ampr.org"},
+		{"Everyone, xndeoc", "Planning Section Chief <XNDEOC@w6xsc.ampr.org>, County EOC <XSCEOC@w2xsc.ampr.org>, Joe Operator <KK6XYZ@w4xsc.ampr.org>, nobody@example.com"},
+	} {
+		if out, err := book.Expand(tt.in); err != nil {
+			t.Errorf("%s: %s", tt.in, err)
+		} else if out != tt.out {
+			t.Errorf("%s: got %q, expected %q", tt.in, out, tt.out)
+		}
+	}
+	if _, err := book.Expand("loop"); !errors.Is(err, ErrLoop) {
+		t.Errorf("loop: got %v, expected ErrLoop", err)
+	}
+	var env = envelope.Envelope{To: "EOCs", Cc: "bad address <"}
+	if err := book.ExpandEnvelope(&env); err == nil || env.To != "EOCs" {
+		t.Errorf("ExpandEnvelope should fail and leave envelope unchanged")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	book, err := Read(strings.NewReader(testBook), "W4XSC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ in, out string }{
+		{"kc6rsc@w6xsc.ampr.org", "Planning Section Chief <kc6rsc@w6xsc.ampr.org>"},
+		{"XSCEOC@W2XSC", "County EOC <XSCEOC@W2XSC>"},
+		{"XSCEOC@W1XSC", "XSCEOC@W1XSC"},
+		{"kk6xyz@w4xsc.ampr.org", "Joe Operator <kk6xyz@w4xsc.ampr.org>"},
+		{"someone@example.com", "someone@example.com"},
+	} {
+		if out := book.Normalize(tt.in); out != tt.out {
+			t.Errorf("%s: got %q, expected %q", tt.in, out, tt.out)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package addrbook
+
+// This file contains the expansion of names into addresses and the
+// normalization of addresses back into names.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rothskeller/packet/envelope"
+)
+
+// Resolve returns the fully qualified addresses for the specified name.  The
+// name may be a tactical call, FCC call, ICS position, alias, or distribution
+// list in the address book, or an address (with or without display name).
+// Addresses with a domain are returned unchanged.  Addresses without a domain
+// that aren't in the address book are qualified with the default BBS.  A
+// distribution list is resolved to the addresses of all of its members.
+func (b *Book) Resolve(name string) (addrs []*envelope.Address, err error) {
+	return b.resolve(name, nil)
+}
+
+func (b *Book) resolve(name string, seen []*List) (addrs []*envelope.Address, err error) {
+	var addr *envelope.Address
+
+	name = strings.TrimSpace(name)
+	if l := b.LookupList(name); l != nil {
+		for _, s := range seen {
+			if s == l {
+				return nil, fmt.Errorf("%s: %w", l.Name, ErrLoop)
+			}
+		}
+		for _, member := range l.Members {
+			maddrs, err := b.resolve(member, append(seen, l))
+			if err != nil {
+				return nil, err
+			}
+			addrs = appendUnique(addrs, maddrs...)
+		}
+		return addrs, nil
+	}
+	if s := b.Lookup(name); s != nil {
+		return []*envelope.Address{b.Address(s)}, nil
+	}
+	if addr, err = envelope.ParseAddress(name); err != nil {
+		return nil, fmt.Errorf("%q is not a known name or a valid address", name)
+	}
+	if strings.Contains(addr.Address, "@") {
+		return []*envelope.Address{addr}, nil
+	}
+	if s := b.Lookup(addr.Address); s != nil {
+		var resolved = b.Address(s)
+		if addr.Name != "" {
+			resolved.Name = addr.Name
+		}
+		return []*envelope.Address{resolved}, nil
+	}
+	addr.Address = qualify(addr.Address, b.DefaultBBS)
+	return []*envelope.Address{addr}, nil
+}
+
+// appendUnique appends the new addresses to the list, skipping any that are
+// already on it.
+func appendUnique(list []*envelope.Address, addrs ...*envelope.Address) []*envelope.Address {
+OUTER:
+	for _, addr := range addrs {
+		for _, have := range list {
+			if strings.EqualFold(have.Address, addr.Address) {
+				continue OUTER
+			}
+		}
+		list = append(list, addr)
+	}
+	return list
+}
+
+// Expand expands a comma-separated list of names and addresses, as found in a
+// To, Cc, or Bcc header, into a list of fully qualified addresses, formatted
+// for use in such a header.  Duplicate addresses are removed.
+func (b *Book) Expand(list string) (expanded string, err error) {
+	var addrs []*envelope.Address
+
+	for _, name := range splitList(list) {
+		naddrs, err := b.Resolve(name)
+		if err != nil {
+			return "", err
+		}
+		addrs = appendUnique(addrs, naddrs...)
+	}
+	var strs = make([]string, len(addrs))
+	for i, addr := range addrs {
+		strs[i] = addr.String()
+	}
+	return strings.Join(strs, ", "), nil
+}
+
+// ExpandEnvelope expands the names in the To, Cc, and Bcc headers of the
+// envelope into fully qualified addresses, as described for Expand.  It should
+// be called before sending a message.  The envelope is unchanged if an error
+// is returned.
+func (b *Book) ExpandEnvelope(env *envelope.Envelope) (err error) {
+	var to, cc, bcc string
+
+	if to, err = b.Expand(env.To); err != nil {
+		return err
+	}
+	if cc, err = b.Expand(env.Cc); err != nil {
+		return err
+	}
+	if bcc, err = b.Expand(env.Bcc); err != nil {
+		return err
+	}
+	env.To, env.Cc, env.Bcc = to, cc, bcc
+	return nil
+}
+
+// splitList splits a comma-separated list of names and addresses.  Commas
+// inside quoted strings, comments, and angle brackets do not split.
+func splitList(list string) (names []string) {
+	var (
+		start   int
+		quoted  bool
+		escaped bool
+		depth   int
+	)
+	for i, r := range list {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+			break
+		case r == '(' || r == '<':
+			depth++
+		case (r == ')' || r == '>') && depth > 0:
+			depth--
+		case r == ',' && depth == 0:
+			if name := strings.TrimSpace(list[start:i]); name != "" {
+				names = append(names, name)
+			}
+			start = i + 1
+		}
+	}
+	if name := strings.TrimSpace(list[start:]); name != "" {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Normalize translates an incoming address into the form known in the address
+// book:  if the address belongs to a station in the address book, it is
+// returned with the station's display name.  (The address itself is kept, so
+// that replies go where the message came from.)  Otherwise, it is returned
+// unchanged.
+func (b *Book) Normalize(address string) string {
+	var (
+		addr    *envelope.Address
+		err     error
+		mailbox string
+		domain  string
+	)
+	if addr, err = envelope.ParseAddress(address); err != nil {
+		return address
+	}
+	mailbox, domain, _ = strings.Cut(addr.Address, "@")
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".ampr.org")
+	for _, s := range b.stations {
+		if !strings.EqualFold(mailbox, s.Tactical) && !strings.EqualFold(mailbox, s.FCC) {
+			continue
+		}
+		var bbs = s.BBS
+		if bbs == "" {
+			bbs = b.DefaultBBS
+		}
+		if domain != "" && bbs != "" && !strings.EqualFold(domain, bbs) {
+			continue
+		}
+		if name := s.DisplayName(); name != "" {
+			addr.Name = name
+		}
+		return addr.String()
+	}
+	return address
+}
+
+// NormalizeEnvelope normalizes the addresses in the From header of the
+// envelope, as described for Normalize.  It should be called after receiving
+// a message.
+func (b *Book) NormalizeEnvelope(env *envelope.Envelope) {
+	var names = splitList(env.From)
+
+	for i, name := range names {
+		names[i] = b.Normalize(name)
+	}
+	env.From = strings.Join(names, ", ")
+}
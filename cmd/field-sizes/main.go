@@ -12,13 +12,13 @@ func main() {
 	for _, mtl := range message.RegisteredTypes {
 		for _, mt := range mtl {
 			m := message.Create(mt.Tag, mt.Version)
-			if m == nil || mt.PDFBase == nil {
+			if m == nil || mt.PDFTemplate() == nil {
 				fmt.Printf("Can't create %s %s.\n", mt.Tag, mt.Version)
 				continue
 			}
 			fmt.Printf("%s %s:\n", mt.Tag, mt.Version)
 			for _, f := range m.Base().Fields {
-				showFieldSize(f, f.PDFRenderer)
+				showFieldSize(f, mt.FieldPDFRenderer(f))
 			}
 		}
 	}
@@ -0,0 +1,71 @@
+// importpdf reads filled-in PDF forms and converts them into messages.
+//
+// usage: importpdf [-type «tag»[:«version»]] «pdf-file»...
+//
+// Each message is written to basename(«pdf-file»).txt, in the same format used
+// for saved messages.  If -type is not given, the message type is determined
+// by matching the layout of the PDF against all known types.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+	"github.com/rothskeller/packet/xscmsg"
+)
+
+func main() {
+	var (
+		mtype   string
+		tag     string
+		version string
+		failed  bool
+	)
+	flag.StringVar(&mtype, "type", "", "message type tag[:version]")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: importpdf [-type tag[:version]] pdf-file...\n")
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	tag, version, _ = strings.Cut(mtype, ":")
+	xscmsg.Register()
+	for _, pfile := range flag.Args() {
+		if err := importPDF(pfile, tag, version); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", pfile, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func importPDF(pfile, tag, version string) (err error) {
+	var (
+		fh   *os.File
+		msg  message.Message
+		env  envelope.Envelope
+		warn message.Warning
+	)
+	if fh, err = os.Open(pfile); err != nil {
+		return err
+	}
+	defer fh.Close()
+	if msg, err = message.ImportPDF(fh, tag, version); err != nil {
+		if !errors.As(err, &warn) {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "WARNING: %s: %s\n", pfile, err)
+	}
+	env.SubjectLine = msg.EncodeSubject()
+	mfile := strings.TrimSuffix(pfile, ".pdf") + ".txt"
+	return os.WriteFile(mfile, []byte(env.RenderSaved(msg.EncodeBody())), 0666)
+}
@@ -0,0 +1,58 @@
+// incident-fsck checks an incident directory for inconsistencies.
+//
+// usage: incident-fsck [-dir «directory»] [-repair]
+//
+// It lists the problems it finds, such as dangling links, receipts for
+// nonexistent messages, unparseable files, stale PDFs, and stale ICS-309 logs.
+// With -repair, it also repairs the problems it can.  -dir gives the incident
+// directory; the default is the current directory.  The exit status is 1 if
+// any unrepaired problems remain.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rothskeller/packet/incident"
+	"github.com/rothskeller/packet/xscmsg"
+)
+
+func main() {
+	var (
+		dir      string
+		repair   bool
+		inc      *incident.Incident
+		problems []incident.Problem
+		failed   bool
+		err      error
+	)
+	flag.StringVar(&dir, "dir", ".", "incident directory")
+	flag.BoolVar(&repair, "repair", false, "repair problems found")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: incident-fsck [-dir directory] [-repair]\n")
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	xscmsg.Register()
+	if inc, err = incident.Open(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	if problems, err = inc.Check(repair); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+		if !p.Repaired {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,58 @@
+// incident-layout reports or changes the way an incident directory records the
+// remote message IDs of its messages.
+//
+// usage: incident-layout [-dir «directory»] [symlink|index]
+//
+// With no argument, it prints the current layout.  With an argument, it
+// converts the incident to that layout.  The "symlink" layout uses symbolic
+// links, which some file systems (e.g. FAT) do not support; the "index" layout
+// uses an index file instead.  -dir gives the incident directory; the default
+// is the current directory.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/rothskeller/packet/incident"
+)
+
+func main() {
+	var (
+		dir    string
+		layout incident.Layout
+		inc    *incident.Incident
+		err    error
+	)
+	flag.StringVar(&dir, "dir", ".", "incident directory")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: incident-layout [-dir directory] [symlink|index]\n")
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if inc, err = incident.Open(dir); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	if flag.NArg() == 0 {
+		fmt.Println(inc.RMILayout())
+		return
+	}
+	switch flag.Arg(0) {
+	case "symlink":
+		layout = incident.SymlinkLayout
+	case "index":
+		layout = incident.IndexLayout
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err = inc.ConvertLayout(layout); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,237 @@
+// pdfcalibrate helps with calibrating the PDF renderers of a message type.
+//
+// usage: pdfcalibrate [-template «pdf-file»] «tag»[:«version»]
+//
+// It renders a message of the specified type with every field filled with its
+// label, showing the field layout and overlaying a grid, and writes the result
+// to «tag»-«version».calibrate.pdf.  It also reports on standard output any
+// text boxes that overlap each other, fall off of the page, or are too small
+// for the EditWidth of their fields.  If -template is given, it is used as the
+// PDF template for the message type rather than the one built into the program.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rothskeller/gofpdf"
+	"github.com/rothskeller/gofpdf/contrib/gofpdi"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+	"github.com/rothskeller/packet/xscmsg"
+)
+
+// textBox is a PDFTextRenderer box for a field.
+type textBox struct {
+	label      string
+	editWidth  int
+	page       int
+	x, y, w, h float64
+}
+
+func main() {
+	var (
+		template string
+		tag      string
+		version  string
+		msg      message.Message
+		mtype    *message.Type
+		tmpdir   string
+		sizes    map[int]map[string]map[string]float64
+		warn     message.Warning
+		boxes    []*textBox
+		err      error
+	)
+	flag.StringVar(&template, "template", "", "PDF template file for message type")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: pdfcalibrate [-template pdf-file] tag[:version]\n")
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	xscmsg.Register()
+	tag, version, _ = strings.Cut(flag.Arg(0), ":")
+	if template != "" {
+		if err = message.LoadPDFBase(tag, version, template); err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			os.Exit(1)
+		}
+	}
+	if msg = message.Create(tag, version); msg == nil {
+		fmt.Fprintf(os.Stderr, "ERROR: can't create message of type %s\n", flag.Arg(0))
+		os.Exit(1)
+	}
+	mtype = msg.Base().Type
+	// Fill each field with its label, and collect the text boxes.
+	for _, f := range msg.Base().Fields {
+		if f.Value != nil {
+			*f.Value = f.Label
+		}
+		boxes = collectTextBoxes(f, mtype.FieldPDFRenderer(f), boxes)
+	}
+	// Render the message with layout shown.  Warnings are expected (labels
+	// aren't valid values for radio buttons, for example), and are ignored.
+	if tmpdir, err = os.MkdirTemp("", "pdfcalibrate"); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(tmpdir)
+	message.ShowLayout = true
+	rendered := filepath.Join(tmpdir, "rendered.pdf")
+	if err = msg.RenderPDF(new(envelope.Envelope), rendered); err != nil && !errors.As(err, &warn) {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	// Overlay the grid on the rendered message.
+	outfn := fmt.Sprintf("%s-%s.calibrate.pdf", mtype.Tag, mtype.Version)
+	if sizes, err = overlayGrid(rendered, outfn); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	reportProblems(boxes, sizes)
+}
+
+// collectTextBoxes adds the text boxes of the supplied renderer, which renders
+// the supplied field, to the list.
+func collectTextBoxes(f *message.Field, r message.PDFRenderer, boxes []*textBox) []*textBox {
+	switch r := r.(type) {
+	case message.PDFMultiRenderer:
+		for _, r2 := range r {
+			boxes = collectTextBoxes(f, r2, boxes)
+		}
+	case *message.PDFTextRenderer:
+		var box = textBox{label: f.Label, editWidth: f.EditWidth, page: r.Page, x: r.X, y: r.Y, w: r.W, h: r.H}
+		if box.page == 0 {
+			box.page = 1
+		}
+		if box.w == 0 {
+			box.w = r.R - r.X
+		}
+		if box.h == 0 {
+			box.h = r.B - r.Y
+		}
+		boxes = append(boxes, &box)
+	}
+	return boxes
+}
+
+// overlayGrid copies the rendered PDF to the output file, overlaying a grid on
+// each page.  It returns the page sizes.
+func overlayGrid(rendered, outfn string) (sizes map[int]map[string]map[string]float64, err error) {
+	var (
+		out = gofpdf.New("P", "pt", "Letter", "")
+		imp = gofpdi.NewImporter()
+	)
+	out.SetAutoPageBreak(false, 0)
+	// Read the first page, just so the importer has the page details.
+	// Ignore the result.
+	imp.ImportPage(out, rendered, 1, "/MediaBox")
+	sizes = imp.GetPageSizes()
+	for pnum := 1; sizes[pnum] != nil; pnum++ {
+		orient := "P"
+		w, h := sizes[pnum]["/MediaBox"]["w"], sizes[pnum]["/MediaBox"]["h"]
+		if w > h {
+			orient = "L"
+		}
+		out.AddPageFormat(orient, gofpdf.SizeType{Wd: w, Ht: h})
+		tpl := imp.ImportPage(out, rendered, pnum, "/MediaBox")
+		imp.UseImportedTemplate(out, tpl, 0, 0, w, h)
+		drawGrid(out)
+	}
+	return sizes, out.OutputFileAndClose(outfn)
+}
+
+// drawGrid draws a grid with lines every 10 points, labeled every 30.
+func drawGrid(out *gofpdf.Fpdf) {
+	w, h := out.GetPageSize()
+	out.SetLineWidth(0.25)
+	out.SetFont("Helvetica", "", 6)
+	out.SetMargins(0, 0, 0)
+	for x, i := 10.0, 0; x < w; x, i = x+10, i+1 {
+		if i%3 == 2 {
+			out.SetDrawColor(0, 255, 0)
+			out.SetTextColor(0, 255, 0)
+		} else {
+			out.SetDrawColor(0, 0, 255)
+			out.SetTextColor(0, 0, 255)
+		}
+		out.Line(x, 0, x, h)
+		if i%3 == 2 {
+			out.MoveTo(x, 0)
+			out.TransformBegin()
+			out.TransformRotate(270, x, 0)
+			out.Write(6, strconv.FormatFloat(x, 'f', -1, 64))
+			out.TransformEnd()
+		}
+	}
+	for y, i := 10.0, 0; y < h; y, i = y+10, i+1 {
+		if i%3 == 2 {
+			out.SetDrawColor(0, 255, 0)
+			out.SetTextColor(0, 255, 0)
+		} else {
+			out.SetDrawColor(0, 0, 255)
+			out.SetTextColor(0, 0, 255)
+		}
+		out.Line(0, y, w, y)
+		if i%3 == 2 {
+			out.Text(0, y, strconv.FormatFloat(y, 'f', -1, 64))
+		}
+	}
+}
+
+// reportProblems reports text boxes that overlap, fall off the page, or are
+// too small for the EditWidth of their fields.
+func reportProblems(boxes []*textBox, sizes map[int]map[string]map[string]float64) {
+	var problems []string
+
+	for i, box := range boxes {
+		if size := sizes[box.page]; size == nil {
+			problems = append(problems, fmt.Sprintf("%q: on page %d, which does not exist", box.label, box.page))
+		} else if w, h := size["/MediaBox"]["w"], size["/MediaBox"]["h"]; box.x < 0 || box.y < 0 || box.x+box.w > w || box.y+box.h > h {
+			problems = append(problems, fmt.Sprintf("%q: box %s falls off of page %d (%gx%g)", box.label, box, box.page, w, h))
+		}
+		if box.w <= 0 || box.h <= 0 {
+			problems = append(problems, fmt.Sprintf("%q: box %s is empty", box.label, box))
+		}
+		for _, other := range boxes[i+1:] {
+			if box.page == other.page && box.x < other.x+other.w && other.x < box.x+box.w &&
+				box.y < other.y+other.h && other.y < box.y+box.h {
+				problems = append(problems, fmt.Sprintf("%q: box %s overlaps %q box %s", box.label, box, other.label, other))
+			}
+		}
+	}
+	problems = append(problems, checkEditWidths(boxes)...)
+	slices.Sort(problems)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+}
+
+// checkEditWidths reports fields whose text boxes are too small for their
+// EditWidth.  It uses the same estimate of characters per point as
+// cmd/field-sizes:  8-point text with an average character width of 0.6 em.
+func checkEditWidths(boxes []*textBox) (problems []string) {
+	for _, box := range boxes {
+		if box.editWidth == 0 {
+			continue
+		}
+		if fits := int(math.Ceil(box.w / (8 * 0.6))); fits < box.editWidth {
+			problems = append(problems, fmt.Sprintf("%q: box %s fits %d characters but EditWidth is %d", box.label, box, fits, box.editWidth))
+		}
+	}
+	return problems
+}
+
+func (box *textBox) String() string {
+	return fmt.Sprintf("[%g,%g %gx%g]", box.x, box.y, box.w, box.h)
+}
@@ -0,0 +1,48 @@
+// qrdecode reconstructs a message from the QR codes on a rendered PDF.
+//
+// usage: qrdecode «message-file» «payload-file»...
+//
+// Each «payload-file» contains the scanned contents of one QR code.  They may
+// be given in any order.  The reconstructed message is written to
+// «message-file», in the same format used for saved messages.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+	"github.com/rothskeller/packet/xscmsg"
+)
+
+func main() {
+	var (
+		payloads []string
+		msg      message.Message
+		env      envelope.Envelope
+		err      error
+	)
+	if len(os.Args) < 3 {
+		fmt.Fprintf(os.Stderr, "usage: qrdecode message-file payload-file...\n")
+		os.Exit(2)
+	}
+	xscmsg.Register()
+	for _, pfile := range os.Args[2:] {
+		payload, err := os.ReadFile(pfile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+			os.Exit(1)
+		}
+		payloads = append(payloads, string(payload))
+	}
+	if msg, err = message.DecodeQRPayloads(&env, payloads); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+	env.SubjectLine = msg.EncodeSubject()
+	if err = os.WriteFile(os.Args[1], []byte(env.RenderSaved(msg.EncodeBody())), 0666); err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -1,7 +1,15 @@
 // renderpdf renders one or more messages into PDFs.
+//
+// usage: renderpdf [-qr] [-template «tag»[:«version»]=«pdf-file»]... «message-file»...
+//
+// The -qr flag adds QR codes containing the message to the PDF.  The -template
+// flag, which may be repeated, supplies the PDF template for the specified
+// message type, overriding the one built into the program (if any).
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
@@ -12,12 +20,18 @@ import (
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "usage: renderpdf message-file...\n")
+	flag.BoolVar(&message.IncludeQRCodes, "qr", false, "include QR codes containing the message")
+	flag.Func("template", "PDF template for message type, as tag[:version]=pdf-file", loadTemplate)
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: renderpdf [-qr] [-template tag[:version]=pdf-file]... message-file...\n")
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
 		os.Exit(2)
 	}
 	xscmsg.Register()
-	for _, mfile := range os.Args[1:] {
+	for _, mfile := range flag.Args() {
 		mbytes, err := os.ReadFile(mfile)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "%s: %s\n", mfile, err)
@@ -42,3 +56,13 @@ func main() {
 		}
 	}
 }
+
+// loadTemplate handles the -template flag.
+func loadTemplate(arg string) error {
+	mtype, pfile, ok := strings.Cut(arg, "=")
+	if !ok || mtype == "" || pfile == "" {
+		return errors.New("expected tag[:version]=pdf-file")
+	}
+	tag, version, _ := strings.Cut(mtype, ":")
+	return message.LoadPDFBase(tag, version, pfile)
+}
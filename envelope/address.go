@@ -3,20 +3,32 @@ package envelope
 // This file contains code for parsing addresses and address lists.
 
 import (
-	"errors"
+	"fmt"
+	"mime"
 	"strings"
 )
 
 // Address is an address that can appear in the header of a message.  It
 // consists of an optional name comment followed by an xxx or xxx@yyy address.
 // It is roughly similar to mail.Address, but does not require the Address part
-// to contain a domain.
+// to contain a domain.  If the address was a member of a group (e.g., "Team:
+// a, b;"), Group is the name of the group.  An Address with a Group but no
+// Address stands for an empty group (e.g., "undisclosed-recipients:;").
+// ParseAddressList omits empty groups, since they have no recipients, but
+// FormatAddressList preserves them.
 type Address struct {
 	Name    string
 	Address string
+	Group   string
 }
 
+// String returns the address in RFC-5322 syntax.  An empty group is rendered
+// in group syntax; a member of a non-empty group is rendered alone, since the
+// group syntax surrounds all of its members (see FormatAddressList).
 func (addr *Address) String() string {
+	if addr.Address == "" && addr.Group != "" {
+		return quotePhrase(addr.Group) + ":;"
+	}
 	var local, domain, _ = strings.Cut(addr.Address, "@")
 	// The local part may need to be quoted.
 	for i, r := range local {
@@ -35,16 +47,22 @@ func (addr *Address) String() string {
 	if addr.Name == "" {
 		return local
 	}
-	// The name may also need to be quoted.
-	var name = addr.Name
+	return quotePhrase(addr.Name) + " <" + local + ">"
+}
+
+// quotePhrase returns a display name or group name, quoted if necessary.  A
+// name that is already quoted (as the parser leaves them) is returned as is.
+func quotePhrase(name string) string {
+	if len(name) > 1 && name[0] == '"' && name[len(name)-1] == '"' {
+		return name
+	}
 	for _, r := range name {
 		if isAText(r) || isWhitespace(r) {
 			continue
 		}
-		name = quoteString(name)
-		break
+		return quoteString(name)
 	}
-	return name + " <" + local + ">"
+	return name
 }
 
 func quoteString(s string) string {
@@ -64,16 +82,22 @@ func quoteString(s string) string {
 This is the grammar we are parsing.  It is exactly as described in RFC-5322
 except for one enhancement
   (1) addr-spec can have a local-part without a domain
-and two limitations
-  (1) no group list syntax
-  (2) no obsolete syntax options
+and one limitation
+  (1) no obsolete syntax options
 The enhancement allows us to send packet messages to other mailboxes on the
 same BBS without an @bbs suffix.  This style of addressing is discouraged but
-common.
+common.  In strict mode, the enhancement is disabled.  Display names may
+contain RFC-2047 encoded words, which are decoded.
 
    address-list    =   (address *("," address))
 
-   address         =   mailbox
+   address         =   mailbox / group
+
+   group           =   display-name ":" [group-list] ";" [CFWS]
+
+   group-list      =   mailbox-list / CFWS
+
+   mailbox-list    =   (mailbox *("," mailbox))
 
    mailbox         =   name-addr / addr-spec
 
@@ -145,113 +169,328 @@ common.
 
 */
 
+// A ParseError is returned when an address or address list cannot be parsed.
+// It describes where in the input the parse failed and what was expected
+// there.
+type ParseError struct {
+	// Input is the string that was being parsed.
+	Input string
+	// Offset is the byte offset in Input at which the parse failed.
+	Offset int
+	// Expected is a description of what was expected at Offset.
+	Expected string
+}
+
+func (e *ParseError) Error() string {
+	if e.Offset >= len(e.Input) {
+		return fmt.Sprintf("expected %s at end of address", e.Expected)
+	}
+	var context = e.Input[e.Offset:]
+	if len(context) > 10 {
+		context = context[:10] + "..."
+	}
+	return fmt.Sprintf("expected %s at position %d, before %q", e.Expected, e.Offset+1, context)
+}
+
+// ParseAddressList parses a comma-separated list of addresses.  Addresses may
+// lack a domain, and groups are flattened into their member addresses.  If the
+// list cannot be parsed, the returned error is a *ParseError.
 func ParseAddressList(s string) (addrs []*Address, err error) {
+	return parseAddressList(s, false)
+}
+
+// ParseAddressListStrict is like ParseAddressList, but it accepts only address
+// lists that are valid according to RFC-5322, i.e., every address must have a
+// domain.
+func ParseAddressListStrict(s string) (addrs []*Address, err error) {
+	return parseAddressList(s, true)
+}
+
+// FormatAddressList normalizes the syntax of an address list:  it parses the
+// list and renders each address with String, separated by sep.  Unlike
+// ParseAddressList, it preserves groups, including empty ones.  If the list
+// cannot be parsed, the returned error is a *ParseError.
+func FormatAddressList(s, sep string) (string, error) {
+	var (
+		p     = addrParser{input: s, groups: true}
+		addrs []*Address
+		sb    strings.Builder
+		err   error
+	)
+	if addrs, err = p.parseAddressList(s); err != nil {
+		return "", err
+	}
+	for i, addr := range addrs {
+		var prev, next string
+
+		if i != 0 {
+			prev = memberGroup(addrs[i-1])
+			sb.WriteString(sep)
+		}
+		if i < len(addrs)-1 {
+			next = memberGroup(addrs[i+1])
+		}
+		if addr.Address != "" && addr.Group != "" && addr.Group != prev {
+			sb.WriteString(quotePhrase(addr.Group))
+			sb.WriteString(": ")
+		}
+		sb.WriteString(addr.String())
+		if addr.Address != "" && addr.Group != "" && addr.Group != next {
+			sb.WriteByte(';')
+		}
+	}
+	return sb.String(), nil
+}
+
+// memberGroup returns the group of which addr is a member, or "" if it isn't
+// a member of one.  (An empty group has no members.)
+func memberGroup(addr *Address) string {
+	if addr.Address == "" {
+		return ""
+	}
+	return addr.Group
+}
+
+func parseAddressList(s string, strict bool) (addrs []*Address, err error) {
+	var p = addrParser{input: s, strict: strict}
+
+	return p.parseAddressList(s)
+}
+
+func (p *addrParser) parseAddressList(s string) (addrs []*Address, err error) {
 	_, s = parseWhitespace(s)
 	if s == "" {
 		return nil, nil
 	}
-	if addr, rest, ok := parseAddress(s); !ok {
-		return nil, errors.New("invalid address list")
+	if list, rest, ok := p.parseAddress(s); !ok {
+		return nil, p.error()
 	} else {
-		addrs = append(addrs, addr)
+		addrs = append(addrs, list...)
 		s = rest
 	}
 	for s != "" {
 		if s[0] != ',' {
-			return nil, errors.New("invalid address list")
+			p.fail(s, `"," or end of list`)
+			return nil, p.error()
 		}
 		s = s[1:]
-		if addr, rest, ok := parseAddress(s); !ok {
-			return nil, errors.New("invalid address list")
+		if list, rest, ok := p.parseAddress(s); !ok {
+			return nil, p.error()
 		} else {
-			addrs = append(addrs, addr)
+			addrs = append(addrs, list...)
 			s = rest
 		}
 	}
 	return addrs, nil
 }
 
+// ParseAddress parses a single address, which may lack a domain.  If it cannot
+// be parsed, the returned error is a *ParseError.
 func ParseAddress(s string) (*Address, error) {
-	addr, rest, ok := parseAddress(s)
-	if !ok || rest != "" {
-		return nil, errors.New("invalid address")
+	return parseSingleAddress(s, false)
+}
+
+// ParseAddressStrict is like ParseAddress, but it accepts only addresses that
+// are valid according to RFC-5322, i.e., the address must have a domain.
+func ParseAddressStrict(s string) (*Address, error) {
+	return parseSingleAddress(s, true)
+}
+
+func parseSingleAddress(s string, strict bool) (*Address, error) {
+	var p = addrParser{input: s, strict: strict}
+
+	addr, rest, ok := p.parseMailbox(s)
+	if !ok {
+		return nil, p.error()
+	}
+	if rest != "" {
+		p.fail(rest, "end of address")
+		return nil, p.error()
 	}
 	return addr, nil
 }
 
-func parseAddress(s string) (addr *Address, rest string, ok bool) {
-	if addr, rest, ok = parseNameAddr(s); ok {
+// addrParser holds the state of a parse of an address or address list.  As
+// alternatives are tried, it tracks the furthest point in the input at which
+// one of them failed, since that is generally the most useful place to report
+// a syntax error.  If groups is true, empty groups are returned as an Address
+// with only a Group.
+type addrParser struct {
+	input    string
+	strict   bool
+	groups   bool
+	failAt   int
+	expected string
+}
+
+// fail records a failure to find what was expected at the start of s.  If
+// several alternatives failed at the same point, their expectations are
+// combined.
+func (p *addrParser) fail(s, expected string) {
+	switch off := len(p.input) - len(s); {
+	case p.expected == "" || off > p.failAt:
+		p.failAt, p.expected = off, expected
+	case off == p.failAt && !strings.Contains(p.expected, expected):
+		p.expected += " or " + expected
+	}
+}
+
+// error returns a ParseError describing the furthest failure.
+func (p *addrParser) error() error {
+	return &ParseError{Input: p.input, Offset: p.failAt, Expected: p.expected}
+}
+
+func (p *addrParser) parseAddress(s string) (addrs []*Address, rest string, ok bool) {
+	if addrs, rest, ok = p.parseGroup(s); ok {
 		return
 	}
-	return parseAddrSpec(s)
+	if addr, rest, ok := p.parseMailbox(s); ok {
+		return []*Address{addr}, rest, true
+	}
+	return nil, "", false
 }
 
-func parseNameAddr(s string) (addr *Address, rest string, ok bool) {
-	var a Address
+func (p *addrParser) parseGroup(s string) (addrs []*Address, rest string, ok bool) {
+	var name string
 
-	for {
-		word, rest, ok := parseWord(s)
-		if !ok {
-			break
+	if name, s, ok = p.parsePhrase(s); !ok {
+		return nil, "", false
+	}
+	if s == "" || s[0] != ':' {
+		p.fail(s, `":"`)
+		return nil, "", false
+	}
+	_, s = parseCommentsWhitespace(s[1:])
+	for s != "" && s[0] != ';' {
+		if len(addrs) != 0 {
+			if s[0] != ',' {
+				p.fail(s, `"," or ";"`)
+				return nil, "", false
+			}
+			s = s[1:]
 		}
-		if a.Name != "" {
-			a.Name += " "
+		addr, rest, ok := p.parseMailbox(s)
+		if !ok {
+			return nil, "", false
 		}
-		a.Name += word
+		addr.Group = name
+		addrs = append(addrs, addr)
 		s = rest
 	}
+	if s == "" {
+		p.fail(s, `";"`)
+		return nil, "", false
+	}
+	if len(addrs) == 0 && p.groups {
+		addrs = []*Address{{Group: name}}
+	}
+	_, s = parseCommentsWhitespace(s[1:])
+	return addrs, s, true
+}
+
+func (p *addrParser) parseMailbox(s string) (addr *Address, rest string, ok bool) {
+	if addr, rest, ok = p.parseNameAddr(s); ok {
+		return
+	}
+	return p.parseAddrSpec(s)
+}
+
+func (p *addrParser) parseNameAddr(s string) (addr *Address, rest string, ok bool) {
+	var a Address
+
+	a.Name, s, _ = p.parsePhrase(s)
+	_, s = parseCommentsWhitespace(s)
 	if s == "" || s[0] != '<' {
+		p.fail(s, `"<"`)
 		return nil, "", false
 	}
 	s = s[1:]
-	if addr, rest, ok := parseAddrSpec(s); !ok {
+	if addr, rest, ok := p.parseAddrSpec(s); !ok {
 		return nil, "", false
 	} else {
 		a.Address = addr.Address
 		s = rest
 	}
 	if s == "" || s[0] != '>' {
+		p.fail(s, `">"`)
 		return nil, "", false
 	}
-	s = s[1:]
+	_, s = parseCommentsWhitespace(s[1:])
 	return &a, s, true
 }
 
-func parseAddrSpec(s string) (addr *Address, rest string, ok bool) {
+// parsePhrase parses a display name, decoding any RFC-2047 encoded words in
+// it.
+func (p *addrParser) parsePhrase(s string) (phrase, rest string, ok bool) {
+	for {
+		word, rest, ok := p.parseWord(s)
+		if !ok {
+			break
+		}
+		if phrase != "" {
+			phrase += " "
+		}
+		phrase += word
+		s = rest
+	}
+	if phrase == "" {
+		return "", s, false
+	}
+	if strings.Contains(phrase, "=?") {
+		var dec = mime.WordDecoder{CharsetReader: charsetReader}
+		if decoded, err := dec.DecodeHeader(phrase); err == nil {
+			phrase = decoded
+		}
+	}
+	return phrase, s, true
+}
+
+func (p *addrParser) parseAddrSpec(s string) (addr *Address, rest string, ok bool) {
 	var a Address
 
-	if lp, rest, ok := parseLocalPart(s); ok {
+	if lp, rest, ok := p.parseLocalPart(s); ok {
 		a.Address = lp
 		s = rest
 	} else {
 		return nil, "", false
 	}
 	if s == "" || s[0] != '@' {
+		if p.strict {
+			p.fail(s, `"@"`)
+			return nil, "", false
+		}
 		return &a, s, true
 	}
-	if dom, rest, ok := parseDomain(s[1:]); ok {
+	if dom, rest, ok := p.parseDomain(s[1:]); ok {
 		a.Address += "@" + dom
-		s = rest
 		return &a, rest, true
 	}
 	return nil, "", false
 }
 
-func parseLocalPart(s string) (lp, rest string, ok bool) {
-	if da, rest, ok := parseDotAtom(s); ok {
+func (p *addrParser) parseLocalPart(s string) (lp, rest string, ok bool) {
+	if da, rest, ok := p.parseDotAtom(s); ok {
 		return da, rest, ok
 	}
-	return parseQuotedString(s)
+	if qs, rest, ok := p.parseQuotedString(s); ok {
+		return qs, rest, ok
+	}
+	p.fail(s, "address")
+	return "", "", false
 }
 
-func parseDomain(s string) (dom, rest string, ok bool) {
-	if da, rest, ok := parseDotAtom(s); ok {
+func (p *addrParser) parseDomain(s string) (dom, rest string, ok bool) {
+	if da, rest, ok := p.parseDotAtom(s); ok {
 		return da, rest, ok
 	}
-	return parseDomainLiteral(s)
+	if dl, rest, ok := p.parseDomainLiteral(s); ok {
+		return dl, rest, ok
+	}
+	p.fail(s, "domain")
+	return "", "", false
 }
 
-func parseDotAtom(s string) (da, rest string, ok bool) {
+func (p *addrParser) parseDotAtom(s string) (da, rest string, ok bool) {
 	_, s = parseCommentsWhitespace(s)
 	if atextrun, rest, ok := parseATextRun(s); ok {
 		da = atextrun
@@ -267,6 +506,7 @@ func parseDotAtom(s string) (da, rest string, ok bool) {
 			break
 		}
 	}
+	_, s = parseCommentsWhitespace(s)
 	return da, s, true
 }
 
@@ -283,7 +523,7 @@ func parseATextRun(s string) (run, rest string, ok bool) {
 	return s[:idx], s[idx:], true
 }
 
-func parseDomainLiteral(s string) (dl, rest string, ok bool) {
+func (p *addrParser) parseDomainLiteral(s string) (dl, rest string, ok bool) {
 	_, s = parseCommentsWhitespace(s)
 	if s == "" || s[0] != '[' {
 		return "", "", false
@@ -292,6 +532,11 @@ func parseDomainLiteral(s string) (dl, rest string, ok bool) {
 		return r != 9 && (r < 32 || (r > 90 && r < 94) || r > 126)
 	})
 	if idx < 0 || s[idx] != ']' {
+		if idx < 0 {
+			p.fail("", `"]"`)
+		} else {
+			p.fail(s[idx:], `"]"`)
+		}
 		return "", "", false
 	}
 	dl = s[:idx+1]
@@ -299,11 +544,11 @@ func parseDomainLiteral(s string) (dl, rest string, ok bool) {
 	return dl, s, true
 }
 
-func parseWord(s string) (word, rest string, ok bool) {
+func (p *addrParser) parseWord(s string) (word, rest string, ok bool) {
 	if word, rest, ok = parseAtom(s); ok {
 		return
 	}
-	return parseQuotedString(s)
+	return p.parseQuotedString(s)
 }
 
 const atextchars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!#$%&'*+-/=?^_`{|}~"
@@ -325,7 +570,7 @@ func parseAtom(s string) (atom, rest string, ok bool) {
 	return atom, s, true
 }
 
-func parseQuotedString(s string) (qs, rest string, ok bool) {
+func (p *addrParser) parseQuotedString(s string) (qs, rest string, ok bool) {
 	_, s = parseCommentsWhitespace(s)
 	if s == "" || s[0] != '"' {
 		return "", "", false
@@ -344,6 +589,7 @@ func parseQuotedString(s string) (qs, rest string, ok bool) {
 		}
 	}
 	if s == "" || s[0] != '"' {
+		p.fail(s, "closing '\"'")
 		return "", "", false
 	}
 	qs, s = qs+s[:1], s[1:]
@@ -373,7 +619,7 @@ func parseQTextRun(s string) (qtrun, rest string, ok bool) {
 	idx := strings.IndexFunc(s, func(r rune) bool {
 		return r != 33 && (r < 35 || r > 91) && (r < 93 || r > 126)
 	})
-	if idx == 0 {
+	if idx == 0 || s == "" {
 		return "", "", false
 	}
 	if idx < 0 {
@@ -435,7 +681,7 @@ func parseCTextRun(s string) (ctrun, rest string, ok bool) {
 	idx := strings.IndexFunc(s, func(r rune) bool {
 		return (r < 33 || r > 39) && (r < 42 || r > 91) && (r < 93 || r > 126)
 	})
-	if idx == 0 {
+	if idx == 0 || s == "" {
 		return "", "", false
 	}
 	if idx < 0 {
@@ -457,7 +703,7 @@ func parseQuotedPair(s string) (pair, rest string, ok bool) {
 func parseWhitespace(s string) (ws, rest string) {
 	idx := strings.IndexFunc(s, func(r rune) bool { return r != ' ' && r != '\t' })
 	if idx < 0 {
-		return "", rest
+		return s, ""
 	}
 	return s[:idx], s[idx:]
 }
@@ -1,7 +1,9 @@
 package envelope
 
 import (
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -48,6 +50,39 @@ func TestParseAddressList(t *testing.T) {
 				{Address: "beta"},
 			},
 		},
+		{
+			name: "list of angle addresses",
+			arg:  "<alpha@x.org>, <beta@x.org>",
+			wantAddrs: []*Address{
+				{Address: "alpha@x.org"},
+				{Address: "beta@x.org"},
+			},
+		},
+		{
+			name: "encoded word display name",
+			arg:  "=?utf-8?q?Se=C3=B1or?= Roth <steve@rothskeller.net>",
+			wantAddrs: []*Address{
+				{Name: "Señor Roth", Address: "steve@rothskeller.net"},
+			},
+		},
+		{
+			name: "group",
+			arg:  "Team: alpha, Beta <beta@x.org>;, gamma",
+			wantAddrs: []*Address{
+				{Address: "alpha", Group: "Team"},
+				{Name: "Beta", Address: "beta@x.org", Group: "Team"},
+				{Address: "gamma"},
+			},
+		},
+		{
+			name: "empty group",
+			arg:  "undisclosed-recipients:;",
+		},
+		{
+			name:    "unterminated group",
+			arg:     "Team: alpha, beta",
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -62,3 +97,88 @@ func TestParseAddressList(t *testing.T) {
 		})
 	}
 }
+
+func TestParseAddressListErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		arg      string
+		strict   bool
+		offset   int
+		expected string
+	}{
+		{"missing close angle", "Steve <steve@rothskeller.net", false, 28, `">"`},
+		{"missing comma", "alpha beta", false, 10, `":" or "<"`},
+		{"unterminated quote", `"Steve <steve@rothskeller.net>`, false, 30, "closing '\"'"},
+		{"missing domain", "steve@", false, 6, "domain"},
+		{"trailing junk", "alpha@x.org; beta", false, 11, `"," or end of list`},
+		{"strict without domain", "alpha", true, 5, `":" or "<" or "@"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.strict {
+				_, err = ParseAddressListStrict(tt.arg)
+			} else {
+				_, err = ParseAddressList(tt.arg)
+			}
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("expected ParseError, got %v", err)
+			}
+			if perr.Offset != tt.offset || perr.Expected != tt.expected {
+				t.Errorf("got offset %d expected %s, want offset %d expected %s", perr.Offset, perr.Expected, tt.offset, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatAddressList(t *testing.T) {
+	tests := []struct {
+		name string
+		arg  string
+		want string
+	}{
+		{"plain list", "alpha,beta@x.org,  <gamma@x.org>", "alpha, beta@x.org, gamma@x.org"},
+		{"empty group", "undisclosed-recipients:;", "undisclosed-recipients:;"},
+		{"group", "Team: a@b,c@d;", "Team: a@b, c@d;"},
+		{"group among addresses", "alpha, Team: Beta <beta@x.org>, gamma;, delta", "alpha, Team: Beta <beta@x.org>, gamma;, delta"},
+		{"single member group", "Team:a@b;", "Team: a@b;"},
+		{"adjacent groups", "One: a;, Two:;, Three: b, c;", "One: a;, Two:;, Three: b, c;"},
+		{"quoted group name", `"Team, Inc.": a;`, `"Team, Inc.": a;`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatAddressList(tt.arg, ", ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("FormatAddressList() = %q, want %q", got, tt.want)
+			}
+			// The result must parse to the same addresses.
+			a1, _ := ParseAddressList(tt.arg)
+			a2, err := ParseAddressList(got)
+			if err != nil || !reflect.DeepEqual(a1, a2) {
+				t.Errorf("reparse = %v, %v; want %v", a2, err, a1)
+			}
+		})
+	}
+	if _, err := FormatAddressList("Team: a, b", ", "); err == nil {
+		t.Error("unterminated group formatted without error")
+	}
+}
+
+func TestRenderSavedGroups(t *testing.T) {
+	var env = Envelope{From: "x@y", To: "undisclosed-recipients:;", Cc: "Team: a@b, c@d;", SubjectLine: "s"}
+	var saved = env.RenderSaved("body\n")
+	if !strings.Contains(saved, "\nTo: undisclosed-recipients:;\n") || !strings.Contains(saved, "\nCc: Team: a@b,\n\tc@d;\n") {
+		t.Errorf("groups not preserved:\n%s", saved)
+	}
+	renv, _, err := ParseSaved(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renv.To != "undisclosed-recipients:;" {
+		t.Errorf("To = %q", renv.To)
+	}
+}
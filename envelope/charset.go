@@ -0,0 +1,92 @@
+package envelope
+
+// This file contains the decoding of received message text in character sets
+// other than UTF-8.
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// windows1252 maps the bytes 0x80 through 0x9F in the Windows-1252 character
+// set to their Unicode code points.  (The other bytes are the same as in
+// ISO-8859-1, i.e., the same as the Unicode code point.)  Bytes undefined in
+// Windows-1252 are mapped to the corresponding C1 control characters.
+var windows1252 = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0x8D, 'Ž', 0x8F,
+	0x90, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0x9D, 'ž', 'Ÿ',
+}
+
+// iso885915 maps the bytes in the ISO-8859-15 character set that differ from
+// ISO-8859-1 to their Unicode code points.
+var iso885915 = map[byte]rune{
+	0xA4: '€', 0xA6: 'Š', 0xA8: 'š', 0xB4: 'Ž', 0xB8: 'ž', 0xBC: 'Œ', 0xBD: 'œ', 0xBE: 'Ÿ',
+}
+
+// normalizeCharset returns the canonical name of the specified character set,
+// if it is one we can decode, or an empty string otherwise.
+func normalizeCharset(charset string) string {
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "", "us-ascii", "ascii", "ansi_x3.4-1968":
+		return "us-ascii"
+	case "utf-8", "utf8":
+		return "utf-8"
+	case "iso-8859-1", "iso8859-1", "iso_8859-1", "latin1", "l1":
+		return "iso-8859-1"
+	case "iso-8859-15", "iso8859-15", "iso_8859-15", "latin-9", "latin9":
+		return "iso-8859-15"
+	case "windows-1252", "cp1252", "x-cp1252":
+		return "windows-1252"
+	}
+	return ""
+}
+
+// decodeCharset converts the supplied text from the specified character set to
+// UTF-8.  It returns the canonical name of the character set that was actually
+// used for decoding.  Text in an unrecognized character set is returned
+// unchanged.  Text that is declared to be US-ASCII (or not declared at all) but
+// is not valid UTF-8 is assumed to be Windows-1252, since that is what most
+// mail software that fails to declare its character set actually sends.
+func decodeCharset(text []byte, charset string) (decoded []byte, actual string) {
+	switch actual = normalizeCharset(charset); actual {
+	case "":
+		return text, strings.ToLower(charset)
+	case "utf-8":
+		return text, actual
+	case "us-ascii":
+		if utf8.Valid(text) {
+			return text, actual
+		}
+		actual = "windows-1252"
+	}
+	var sb strings.Builder
+	for _, b := range text {
+		switch {
+		case b < 0x80:
+			sb.WriteByte(b)
+		case actual == "windows-1252" && b < 0xA0:
+			sb.WriteRune(windows1252[b-0x80])
+		case actual == "iso-8859-15" && iso885915[b] != 0:
+			sb.WriteRune(iso885915[b])
+		default:
+			sb.WriteRune(rune(b))
+		}
+	}
+	return []byte(sb.String()), actual
+}
+
+// charsetReader is a mime.WordDecoder CharsetReader for the character sets
+// that decodeCharset can handle.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	if normalizeCharset(charset) == "" {
+		return nil, fmt.Errorf("unsupported charset %q", charset)
+	}
+	text, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	text, _ = decodeCharset(text, charset)
+	return strings.NewReader(string(text)), nil
+}
@@ -3,7 +3,12 @@
 // receiving, and storage.
 package envelope
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // An Envelope structure contains the envelope of a packet message.
 type Envelope struct {
@@ -33,10 +38,17 @@ type Envelope struct {
 	// message, from the "From:" header.  In the vast majority of cases,
 	// there's only one address on the list.
 	From string
-	// To is a comma-separated list of destination addresses for the
-	// message, from the "To:", "Cc:", and "Bcc:" headers (we don't
-	// distinguish).
+	// To is a comma-separated list of primary destination addresses for
+	// the message, from the "To:" header.  (Messages saved by older
+	// versions of this package have all destination addresses here.)
 	To string
+	// Cc is a comma-separated list of carbon-copy destination addresses
+	// for the message, from the "Cc:" header.
+	Cc string
+	// Bcc is a comma-separated list of blind carbon-copy destination
+	// addresses for the message, from the "Bcc:" header.  It is set only
+	// for outgoing messages; it is not sent over the air.
+	Bcc string
 	// Date is the date/time at which the message was sent, from the Date:
 	// header.  It is set only for messages that have gone over the air
 	// (received or transmitted).
@@ -47,6 +59,12 @@ type Envelope struct {
 	// in plain text encoding.  This is a non-persistent field, set only for
 	// messages retrieved from JNOS (as opposed to local storage).
 	NotPlainText bool
+	// Charset is the character set in which the plain text body of the
+	// received message was encoded, before conversion to UTF-8 (e.g.
+	// "us-ascii", "utf-8", "iso-8859-1", or "windows-1252").  This is a
+	// non-persistent field, set only for messages retrieved from JNOS (as
+	// opposed to local storage).
+	Charset string
 	// OutpostUrgent is a flag indicating that Outpost considers this
 	// message to be urgent.  (In Santa Clara County this normally
 	// correlates with an "IMMEDIATE" handling order.)
@@ -66,6 +84,96 @@ type Envelope struct {
 	// Bulletin is a flag indicating that this message is a bulletin (either
 	// incoming or outgoing).
 	Bulletin bool
+	// Priority is the sending priority of the (outgoing, untransmitted)
+	// message, relative to other queued messages.
+	Priority Priority
+	// Expires is the time after which the (outgoing, untransmitted) message
+	// should no longer be sent.  It is zero if the message does not expire.
+	Expires time.Time
+	// ReplyBy is the deadline by which a reply to the message is needed.
+	// It is zero if there is no deadline.
+	ReplyBy time.Time
+	// ReadDate is the time at which the (received) message was first read
+	// by an operator.  It is zero if the message has not been read.  This
+	// field is ignored for outgoing messages.
+	ReadDate time.Time
+	// Hops is the list of BBSes that relayed the message, in the order
+	// the message traversed them, as recorded in the BBS routing ("R:")
+	// lines at the top of the received message body.  It is set only for
+	// received messages, and not necessarily all of those.
+	Hops []Hop
+	// Attachments is the list of non-text parts of the message, e.g.
+	// photos or PDFs attached by an email gateway.  This is a
+	// non-persistent field, set only on messages retrieved from JNOS (as
+	// opposed to local storage).
+	Attachments []Attachment
+}
+
+// Priority is the sending priority of a message.
+type Priority int
+
+// Values for Priority.
+const (
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+	PriorityLow    Priority = -1
+)
+
+// String returns the name of the priority, as used in the X-Packet-Priority
+// header.
+func (p Priority) String() string {
+	switch {
+	case p > PriorityNormal:
+		return "high"
+	case p < PriorityNormal:
+		return "low"
+	}
+	return "normal"
+}
+
+// ParsePriority parses a priority name.
+func ParsePriority(s string) (p Priority, err error) {
+	switch strings.ToLower(s) {
+	case "high":
+		return PriorityHigh, nil
+	case "normal", "":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	}
+	return PriorityNormal, fmt.Errorf("invalid priority %q", s)
+}
+
+// ErrExpired is returned by CheckSend for a message whose expiration time has
+// passed.
+var ErrExpired = errors.New("message has expired")
+
+// IsExpired returns whether the message has an expiration time that has
+// passed.
+func (env *Envelope) IsExpired() bool {
+	return !env.Expires.IsZero() && !now().Before(env.Expires)
+}
+
+// CheckSend returns an error if the message should not be transmitted:
+// ErrExpired if it has expired.  It should be called immediately before
+// transmitting a queued message.
+func (env *Envelope) CheckSend() error {
+	if env.IsExpired() {
+		return ErrExpired
+	}
+	return nil
+}
+
+// Recipients returns a comma-separated list of all destination addresses for
+// the message:  those in To, Cc, and Bcc, in that order.
+func (env *Envelope) Recipients() string {
+	var all []string
+	for _, list := range []string{env.To, env.Cc, env.Bcc} {
+		if list != "" {
+			all = append(all, list)
+		}
+	}
+	return strings.Join(all, ", ")
 }
 
 // IsReceived returns whether the message was received (as opposed to sent or
@@ -0,0 +1,137 @@
+package envelope
+
+// This file contains the handling of BBS routing ("R:") lines, which are added
+// to the top of a message body by each BBS that forwards the message.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A Hop describes one BBS that relayed a message, as recorded in the BBS
+// routing ("R:") lines of the message.
+type Hop struct {
+	// BBS is the name of the BBS, without any hierarchical routing
+	// suffix (e.g., "W6XSC" rather than "W6XSC.#NCA.CA.USA.NOAM").
+	BBS string
+	// Time is the time at which the BBS received the message.  It has
+	// only minute resolution.
+	Time time.Time
+	// MessageNumber is the message number assigned by the BBS, if it
+	// recorded one.
+	MessageNumber string
+}
+
+// routingLineRE matches a single BBS routing line, and the others extract the
+// BBS name and message number from it.  JNOS writes routing lines as
+//
+//	R:240315/1423z @:W6XSC.#NCA.CA.USA.NOAM [San Jose] #:1234 $:1234_W6XSC
+//
+// and FBB-style BBSes write them as
+//
+//	R:240315/1423Z 1234@W6XSC.#NCA.CA.USA.NOAM
+var (
+	routingLineRE = regexp.MustCompile(`^R:(\d{6}/\d{4})([zZ]?) (.*)$`)
+	jnosRoutingRE = regexp.MustCompile(`@:([^\s.]+)`)
+	jnosNumberRE  = regexp.MustCompile(`#:(\d+)`)
+	fbbRoutingRE  = regexp.MustCompile(`(?:^|\s)(\d*)@([^\s.:]+)`)
+)
+
+// parseRoutingLines parses the supplied BBS routing lines, which are in the
+// order they appear at the top of the message body, and returns the
+// corresponding hops in the order the message traversed them (i.e., reversed,
+// since each BBS adds its line at the top).  Lines that can't be parsed are
+// skipped.
+func parseRoutingLines(lines []string) (hops []Hop) {
+	for i := len(lines) - 1; i >= 0; i-- {
+		var (
+			hop   Hop
+			loc   = time.Local
+			match = routingLineRE.FindStringSubmatch(lines[i])
+			err   error
+		)
+		if match == nil {
+			continue
+		}
+		if match[2] != "" {
+			loc = time.UTC
+		}
+		if hop.Time, err = time.ParseInLocation("060102/1504", match[1], loc); err != nil {
+			continue
+		}
+		if m := jnosRoutingRE.FindStringSubmatch(match[3]); m != nil {
+			hop.BBS = strings.ToUpper(m[1])
+			if m := jnosNumberRE.FindStringSubmatch(match[3]); m != nil {
+				hop.MessageNumber = m[1]
+			}
+		} else if m := fbbRoutingRE.FindStringSubmatch(match[3]); m != nil {
+			hop.BBS, hop.MessageNumber = strings.ToUpper(m[2]), m[1]
+		} else {
+			continue
+		}
+		hops = append(hops, hop)
+	}
+	return hops
+}
+
+// renderHop renders a hop as the value of an X-Packet-Hop header.
+func renderHop(hop Hop) string {
+	var number = hop.MessageNumber
+	if number == "" {
+		number = "-"
+	}
+	return fmt.Sprintf("%s %s %s", hop.BBS, number, hop.Time.Format(time.RFC1123Z))
+}
+
+// parseHop parses the value of an X-Packet-Hop header.
+func parseHop(s string) (hop Hop, err error) {
+	var fields = strings.SplitN(s, " ", 3)
+
+	if len(fields) != 3 {
+		return Hop{}, fmt.Errorf("incorrect X-Packet-Hop: header format %q", s)
+	}
+	if hop.Time, err = time.Parse(time.RFC1123Z, fields[2]); err != nil {
+		return Hop{}, fmt.Errorf("incorrect X-Packet-Hop: header format %q", s)
+	}
+	hop.BBS = fields[0]
+	if fields[1] != "-" {
+		hop.MessageNumber = fields[1]
+	}
+	return hop, nil
+}
+
+// HopLatencies returns the latency of each hop in the message's BBS routing:
+// the time between the previous hop (or the message's Date, for the first hop)
+// and the hop's receipt of the message.  The latency of the first hop is zero
+// if the message has no Date.  Since BBS routing times have only minute
+// resolution, so do the latencies.
+func (env *Envelope) HopLatencies() (latencies []time.Duration) {
+	var prev = env.Date.Truncate(time.Minute)
+
+	for _, hop := range env.Hops {
+		if prev.IsZero() {
+			latencies = append(latencies, 0)
+		} else {
+			latencies = append(latencies, hop.Time.Sub(prev))
+		}
+		prev = hop.Time
+	}
+	return latencies
+}
+
+// TransitLatency returns the end-to-end latency of the message's BBS routing:
+// the time between the message's Date (or the first hop, if the message has no
+// Date) and the last hop's receipt of the message.  It returns zero if the
+// message has no BBS routing information.
+func (env *Envelope) TransitLatency() time.Duration {
+	if len(env.Hops) == 0 {
+		return 0
+	}
+	var start = env.Date.Truncate(time.Minute)
+	if start.IsZero() {
+		start = env.Hops[0].Time
+	}
+	return env.Hops[len(env.Hops)-1].Time.Sub(start)
+}
@@ -0,0 +1,156 @@
+package envelope
+
+// This file contains the reading and writing of mbox files (RFC 4155), which
+// are used to import messages from, and export them to, other mail software.
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// quotedFromRE matches a body line that needs quoting (when writing) or
+// unquoting (when reading) in "mboxrd" format:  a line starting with "From ",
+// preceded by zero or more ">" characters.
+var quotedFromRE = regexp.MustCompile(`^>*From `)
+
+// An MboxReader reads messages from an mbox file.
+type MboxReader struct {
+	r    *bufio.Reader
+	next string // the "From " line of the next message, if already read
+	err  error
+}
+
+// NewMboxReader returns a new MboxReader reading from the supplied reader.
+func NewMboxReader(r io.Reader) *MboxReader {
+	return &MboxReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next message in the mbox file, including its envelope
+// "From " line, in a form suitable for passing to ParseRetrieved.  Quoted
+// "From " lines in the message body are unquoted following the "mboxrd"
+// convention, which also handles "mboxo" files (such as those written by
+// Thunderbird) except for body lines that originally started with ">From ".
+// Line endings are normalized to newlines.  Next returns io.EOF when there are
+// no more messages.
+func (mr *MboxReader) Next() (raw string, err error) {
+	var sb strings.Builder
+
+	// Find the "From " line starting the next message.  Anything before
+	// the first one is ignored.
+	for mr.next == "" {
+		var line string
+
+		if mr.err != nil {
+			return "", mr.err
+		}
+		if line, mr.err = mr.readLine(); strings.HasPrefix(line, "From ") {
+			mr.next = line
+		}
+	}
+	sb.WriteString(mr.next)
+	mr.next = ""
+	// Read the message up to the next "From " line or end of file.
+	var blanks int
+	for mr.err == nil {
+		var line string
+
+		line, mr.err = mr.readLine()
+		if strings.HasPrefix(line, "From ") {
+			mr.next = line
+			break
+		}
+		if mr.err != nil && line == "" {
+			break
+		}
+		// Hold back blank lines, since the last one before the next
+		// message is a separator rather than part of the message.
+		if line == "\n" {
+			blanks++
+			continue
+		}
+		for ; blanks > 0; blanks-- {
+			sb.WriteByte('\n')
+		}
+		if quotedFromRE.MatchString(line) {
+			line = line[1:]
+		}
+		sb.WriteString(line)
+	}
+	if blanks > 1 {
+		sb.WriteString(strings.Repeat("\n", blanks-1))
+	}
+	if mr.err != nil && mr.err != io.EOF {
+		return "", mr.err
+	}
+	return sb.String(), nil
+}
+
+// readLine reads a single line from the mbox file, normalizing its line ending
+// to a newline.  It returns a partial final line with a newline added.
+func (mr *MboxReader) readLine() (line string, err error) {
+	if line, err = mr.r.ReadString('\n'); line == "" {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n") + "\n"
+	return line, err
+}
+
+// An MboxWriter writes messages to an mbox file.
+type MboxWriter struct {
+	w io.Writer
+}
+
+// NewMboxWriter returns a new MboxWriter writing to the supplied writer.
+func NewMboxWriter(w io.Writer) *MboxWriter {
+	return &MboxWriter{w: w}
+}
+
+// Write writes the supplied envelope and body to the mbox file, in the form
+// rendered by RenderSaved, preceded by an envelope "From " line and followed
+// by a blank line.  Body lines starting with "From " (with or without
+// preceding ">" characters) are quoted with an additional ">", following the
+// "mboxrd" convention.  Any supplied headers (complete "Name: value" lines,
+// without newlines) are written ahead of the rendered ones; ParseSaved
+// ignores headers it doesn't know.
+func (mw *MboxWriter) Write(env *Envelope, body string, headers ...string) (err error) {
+	var (
+		sb     strings.Builder
+		saved  = env.RenderSaved(body)
+		sender = env.ReturnAddr
+		date   = env.Date
+	)
+	if sender == "" {
+		if addrs, err := ParseAddressList(env.From); err == nil && len(addrs) != 0 {
+			sender = addrs[0].Address
+		} else {
+			sender = "MAILER-DAEMON"
+		}
+	}
+	if env.IsReceived() {
+		date = env.ReceivedDate
+	}
+	if date.IsZero() {
+		date = now()
+	}
+	fmt.Fprintf(&sb, "From %s %s\n", sender, date.UTC().Format(time.ANSIC))
+	for _, header := range headers {
+		sb.WriteString(header)
+		sb.WriteByte('\n')
+	}
+	for _, line := range strings.SplitAfter(saved, "\n") {
+		if quotedFromRE.MatchString(line) {
+			sb.WriteByte('>')
+		}
+		sb.WriteString(line)
+	}
+	if !strings.HasSuffix(saved, "\n") {
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+	_, err = io.WriteString(mw.w, sb.String())
+	return err
+}
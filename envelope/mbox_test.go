@@ -0,0 +1,72 @@
+package envelope
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMboxRoundTrip(t *testing.T) {
+	var (
+		buf    bytes.Buffer
+		mw     = NewMboxWriter(&buf)
+		bodies = []string{"From the top\n>From quoted\nnothing\n", "second\n\n"}
+	)
+	for i, body := range bodies {
+		var env Envelope
+		env.From = "Nobody <nobody@nowhere>"
+		env.To = "somebody@somewhere"
+		env.SubjectLine = "Message " + string(rune('1'+i))
+		env.Date = time.Date(2021, 12, 1, 8, 4, 29, 0, time.UTC)
+		if err := mw.Write(&env, body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.HasPrefix(buf.String(), "From nobody@nowhere Wed Dec  1 08:04:29 2021\n") {
+		t.Fatalf("incorrect envelope line in %q", buf.String())
+	}
+	if !strings.Contains(buf.String(), "\n>From the top\n>>From quoted\n") {
+		t.Fatalf("incorrect quoting in %q", buf.String())
+	}
+	var mr = NewMboxReader(&buf)
+	for i, body := range bodies {
+		raw, err := mr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, raw, _ = strings.Cut(raw, "\n")
+		env, rbody, err := ParseSaved(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if env.SubjectLine != "Message "+string(rune('1'+i)) {
+			t.Errorf("message %d: subject %q", i, env.SubjectLine)
+		}
+		if rbody != body {
+			t.Errorf("message %d: body %q should be %q", i, rbody, body)
+		}
+	}
+	if _, err := mr.Next(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
+
+func TestMboxReaderCRLF(t *testing.T) {
+	const mbox = "preamble\r\nFrom - Wed Dec  1 08:04:29 2021\r\nSubject: one\r\n\r\nbody\r\n\r\nFrom - Wed Dec  1 08:05:29 2021\r\nSubject: two\r\n\r\nbody"
+	var mr = NewMboxReader(strings.NewReader(mbox))
+	for _, expected := range []string{
+		"From - Wed Dec  1 08:04:29 2021\nSubject: one\n\nbody\n",
+		"From - Wed Dec  1 08:05:29 2021\nSubject: two\n\nbody\n",
+	} {
+		if raw, err := mr.Next(); err != nil {
+			t.Fatal(err)
+		} else if raw != expected {
+			t.Errorf("message %q should be %q", raw, expected)
+		}
+	}
+	if _, err := mr.Next(); err != io.EOF {
+		t.Fatalf("expected EOF, got %v", err)
+	}
+}
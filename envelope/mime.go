@@ -0,0 +1,140 @@
+package envelope
+
+// This file contains the MIME rendering of outgoing messages, used for
+// messages sent to internet gateways (e.g. Winlink or SMTP) rather than to
+// packet BBS addresses.
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// An Attachment is a file attached to a MIME-rendered message.
+type Attachment struct {
+	// Filename is the name of the attached file, without any directory.
+	Filename string
+	// MediaType is the MIME media type of the attached file, e.g.
+	// "application/pdf".  If it is empty, it is guessed from the
+	// filename extension.
+	MediaType string
+	// Data is the content of the attached file.
+	Data []byte
+}
+
+// UsesMIME returns whether messages sent to the specified address should be
+// rendered with RenderMIME rather than RenderBody.  It can be replaced by
+// callers with different knowledge of which addresses are gateways.  The
+// default implementation returns true for addresses with a domain, other than
+// those in the ampr.org (packet radio) domain.
+var UsesMIME = func(addr string) bool {
+	if a, err := ParseAddress(addr); err == nil {
+		addr = a.Address
+	}
+	_, domain, found := strings.Cut(addr, "@")
+	if !found {
+		return false
+	}
+	domain = strings.ToLower(domain)
+	return domain != "ampr.org" && !strings.HasSuffix(domain, ".ampr.org")
+}
+
+// MIMERecipients splits the destination addresses of the message (To, Cc, and
+// Bcc) into those that should receive the message rendered with RenderBody and
+// those that should receive it rendered with RenderMIME, as determined by
+// UsesMIME.  The returned addresses are bare addresses, without display names.
+func (env *Envelope) MIMERecipients() (plain, gateway []string) {
+	addrs, err := ParseAddressList(env.Recipients())
+	if err != nil {
+		return nil, nil
+	}
+	for _, addr := range addrs {
+		if UsesMIME(addr.Address) {
+			gateway = append(gateway, addr.Address)
+		} else {
+			plain = append(plain, addr.Address)
+		}
+	}
+	return plain, gateway
+}
+
+// RenderMIME renders the supplied envelope, body, and attachments as a complete
+// multipart MIME message, suitable for sending through an internet gateway.
+// The first part of the message is the plain text body (including any Outpost
+// codes), in UTF-8 with quoted-printable encoding; the attachments follow it.
+// The Bcc recipients are not included in the headers.  Lines end with CRLF,
+// as required for internet mail.
+func (env *Envelope) RenderMIME(body string, attachments ...Attachment) string {
+	var (
+		sb    strings.Builder
+		parts bytes.Buffer
+		mw    = multipart.NewWriter(&parts)
+		date  = env.Date
+	)
+	if date.IsZero() {
+		date = now()
+	}
+	renderAddressHeader(&sb, "From", env.From)
+	renderAddressHeader(&sb, "To", env.To)
+	renderAddressHeader(&sb, "Cc", env.Cc)
+	if env.SubjectLine != "" {
+		fmt.Fprintf(&sb, "Subject: %s\n", mime.QEncoding.Encode("utf-8", env.SubjectLine))
+	}
+	fmt.Fprintf(&sb, "Date: %s\n", date.Format(time.RFC1123Z))
+	fmt.Fprintf(&sb, "MIME-Version: 1.0\nContent-Type: %s\n\n",
+		mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": mw.Boundary()}))
+	// Write the plain text part.
+	pw, _ := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	qw := quotedprintable.NewWriter(pw)
+	qw.Write([]byte(env.outpostCodes() + body))
+	qw.Close()
+	// Write the attachments.
+	for _, att := range attachments {
+		mediatype := att.MediaType
+		if mediatype == "" {
+			if idx := strings.LastIndexByte(att.Filename, '.'); idx >= 0 {
+				mediatype = mime.TypeByExtension(att.Filename[idx:])
+			}
+			if mediatype == "" {
+				mediatype = "application/octet-stream"
+			}
+		}
+		aw, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {mime.FormatMediaType(mediatype, map[string]string{"name": att.Filename})},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename})},
+			"Content-Transfer-Encoding": {"base64"},
+		})
+		encoded := base64.StdEncoding.EncodeToString(att.Data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(aw, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(aw, "%s\r\n", encoded)
+	}
+	mw.Close()
+	return strings.ReplaceAll(sb.String(), "\n", "\r\n") + parts.String()
+}
+
+// outpostCodes returns the Outpost codes for the flags in the envelope.
+func (env *Envelope) outpostCodes() string {
+	var sb strings.Builder
+	if env.OutpostUrgent {
+		sb.WriteString("!URG!")
+	}
+	if env.RequestDeliveryReceipt {
+		sb.WriteString("!RDR!")
+	}
+	if env.RequestReadReceipt {
+		sb.WriteString("!RRR!")
+	}
+	return sb.String()
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"mime"
 	"mime/multipart"
@@ -75,7 +76,7 @@ func ParseRetrieved(retrieved, bbs, area string) (_ *Envelope, body string, err
 	}
 	// Extract the plain text portion of the body.
 	bbuf, _ = io.ReadAll(mm.Body)
-	bbuf, env.NotPlainText, err = extractPlainText(textproto.MIMEHeader(mm.Header), bbuf)
+	bbuf, env.NotPlainText, err = env.extractPlainText(textproto.MIMEHeader(mm.Header), bbuf, "")
 	if err == nil && env.NotPlainText && len(bbuf) == 0 {
 		err = ErrNoPlainTextBody
 	}
@@ -89,9 +90,12 @@ func ParseRetrieved(retrieved, bbs, area string) (_ *Envelope, body string, err
 
 // extractPlainText extracts the plain text portion of a message from its body.
 // It returns a nil body if there is none.  The returned boolean indicates
-// whether the entire body was plain text.  This is a recursive function, to
-// handled nested multipart bodies.
-func extractPlainText(header textproto.MIMEHeader, body []byte) (nbody []byte, notplain bool, err error) {
+// whether the entire body was plain text.  Any non-text parts of the body are
+// added to env.Attachments, except for the alternative renderings in a
+// multipart/alternative body.  This is a recursive function, to handled nested
+// multipart bodies; container is the media type of the multipart body
+// containing this one, or empty for the top-level body.
+func (env *Envelope) extractPlainText(header textproto.MIMEHeader, body []byte, container string) (nbody []byte, notplain bool, err error) {
 	var (
 		mediatype string
 		params    map[string]string
@@ -142,7 +146,7 @@ func extractPlainText(header textproto.MIMEHeader, body []byte) (nbody []byte, n
 				return nil, false, err // Can't decode multipart body
 			}
 			partbody, _ = io.ReadAll(part)
-			plain, _, err := extractPlainText(part.Header, partbody)
+			plain, _, err := env.extractPlainText(part.Header, partbody, mediatype)
 			if err != nil {
 				return nil, false, err
 			}
@@ -152,16 +156,57 @@ func extractPlainText(header textproto.MIMEHeader, body []byte) (nbody []byte, n
 		}
 		return found, true, nil
 	}
-	// If the content type is anything other than text/plain, we're out of
-	// luck.
-	if mediatype != "text/plain" {
+	// If the content type is anything other than text/plain, or the part
+	// is explicitly an attachment, we're out of luck as far as the body is
+	// concerned.  But if it's a part of a multipart body, we keep it as an
+	// attachment.
+	disposition, dparams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if mediatype != "text/plain" || disposition == "attachment" {
+		if container != "" && (container != "multipart/alternative" || disposition == "attachment") {
+			env.addAttachment(mediatype, params, dparams, body)
+		}
 		return nil, true, nil
 	}
-	// In theory we also ought to check the charset, but we'll elide that
-	// until experience proves a need.
+	// Convert the text to UTF-8 if needed.
+	body, env.Charset = decodeCharset(body, params["charset"])
 	return body, notplain, nil
 }
 
+// addAttachment adds an attachment to the envelope.
+func (env *Envelope) addAttachment(mediatype string, params, dparams map[string]string, body []byte) {
+	var filename = dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename == "" {
+		filename = fmt.Sprintf("attachment%d", len(env.Attachments)+1)
+		if ext, ok := attachmentExtensions[mediatype]; ok {
+			filename += ext
+		} else if exts, _ := mime.ExtensionsByType(mediatype); len(exts) != 0 {
+			filename += exts[0]
+		}
+	}
+	env.Attachments = append(env.Attachments, Attachment{Filename: filename, MediaType: mediatype, Data: body})
+}
+
+// attachmentExtensions gives the preferred file name extensions for common
+// attachment media types.  Other types get the first extension known to the
+// mime package, which depends on the host's MIME type tables (e.g., it may
+// give ".jfif" for a JPEG).
+var attachmentExtensions = map[string]string{
+	"application/msword": ".doc",
+	"application/pdf":    ".pdf",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       ".xlsx",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": ".docx",
+	"application/zip": ".zip",
+	"image/gif":       ".gif",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"text/csv":        ".csv",
+	"text/html":       ".html",
+	"text/plain":      ".txt",
+}
+
 // receivedRE is the regular expression for the "Received: " line that this
 // package generates when saving a received message.
 var receivedRE = regexp.MustCompile(`^FROM (\S+)\.ampr\.org BY pktmsg.local(?: FOR (\S+))?; (\w\w\w, \d\d \w\w\w \d\d\d\d \d\d:\d\d:\d\d [-+]\d\d\d\d)$`)
@@ -181,6 +226,37 @@ func (env *Envelope) parseHeadersStored(h mail.Header) error {
 			return errors.New("incorrect Received: header format for stored received message")
 		}
 	}
+	for _, line := range h["X-Packet-Hop"] {
+		hop, err := parseHop(line)
+		if err != nil {
+			return err
+		}
+		env.Hops = append(env.Hops, hop)
+	}
+	if pri := h.Get("X-Packet-Priority"); pri != "" {
+		var err error
+		if env.Priority, err = ParsePriority(pri); err != nil {
+			return err
+		}
+	}
+	if exp := h.Get("X-Packet-Expires"); exp != "" {
+		var err error
+		if env.Expires, err = time.Parse(time.RFC1123Z, exp); err != nil {
+			return fmt.Errorf("incorrect X-Packet-Expires: header format %q", exp)
+		}
+	}
+	if rby := h.Get("X-Packet-Reply-By"); rby != "" {
+		var err error
+		if env.ReplyBy, err = time.Parse(time.RFC1123Z, rby); err != nil {
+			return fmt.Errorf("incorrect X-Packet-Reply-By: header format %q", rby)
+		}
+	}
+	if read := h.Get("X-Packet-Read"); read != "" {
+		var err error
+		if env.ReadDate, err = time.Parse(time.RFC1123Z, read); err != nil {
+			return fmt.Errorf("incorrect X-Packet-Read: header format %q", read)
+		}
+	}
 	env.ReadyToSend = h.Get("X-Packet-Queued") != ""
 	if h.Get("X-Packet-Bulletin") != "" {
 		env.Bulletin = true
@@ -232,6 +308,13 @@ func (env *Envelope) parseHeadersRetrieved(h mail.Header, efrom string) {
 			env.ReturnAddr = addrs[0].Address
 		}
 	}
+	// Decode any RFC 2047 encoded words in the subject line.
+	if strings.Contains(env.SubjectLine, "=?") {
+		var dec = mime.WordDecoder{CharsetReader: charsetReader}
+		if subject, err := dec.DecodeHeader(env.SubjectLine); err == nil {
+			env.SubjectLine = subject
+		}
+	}
 	// If we didn't get a BBS Rx date from the envelope, get it from the
 	// Received header.
 	if env.BBSReceivedDate.IsZero() {
@@ -246,10 +329,9 @@ func (env *Envelope) parseHeadersRetrieved(h mail.Header, efrom string) {
 // parseHeadersRetrieved.
 func (env *Envelope) parseHeadersCommon(h mail.Header) {
 	env.From = strings.Join(h["From"], ", ")
-	var to = h["To"]
-	to = append(to, h["Cc"]...)
-	to = append(to, h["Bcc"]...)
-	env.To = strings.Join(to, ", ")
+	env.To = strings.Join(h["To"], ", ")
+	env.Cc = strings.Join(h["Cc"], ", ")
+	env.Bcc = strings.Join(h["Bcc"], ", ")
 	if t, err := mail.ParseDate(h.Get("Date")); err == nil {
 		env.Date = t
 	}
@@ -265,8 +347,13 @@ func (env *Envelope) parseOutpost(original string) (string, error) {
 		body  string
 	)
 	// If the message passed through the BBS network, routing headers may
-	// have been added at the top of the body.  Remove those.
-	original = bbsRoutingRE.ReplaceAllLiteralString(original, "")
+	// have been added at the top of the body.  Record and remove those.
+	if routing := bbsRoutingRE.FindString(original); routing != "" {
+		if env.Hops == nil {
+			env.Hops = parseRoutingLines(strings.Split(strings.TrimRight(routing, "\n"), "\n"))
+		}
+		original = original[len(routing):]
+	}
 	body = original
 	for {
 		switch {
@@ -42,7 +42,9 @@ var savedTests = []struct {
 		saved: "From: <nobody@nowhere>\nTo: <somebody@somewhere>\nCc: <number2@somewhere>\nBcc: <number3@somewhere>\nSubject: Hello, World\nDate: Wed, 1 Dec 2021 08:04:29 +0000\n\nnothing\n",
 		env: &Envelope{
 			From:        "<nobody@nowhere>",
-			To:          "<somebody@somewhere>, <number2@somewhere>, <number3@somewhere>",
+			To:          "<somebody@somewhere>",
+			Cc:          "<number2@somewhere>",
+			Bcc:         "<number3@somewhere>",
 			Date:        time.Date(2021, 12, 1, 8, 4, 29, 0, time.FixedZone("", 0)),
 			SubjectLine: "Hello, World",
 		},
@@ -139,6 +141,7 @@ var retrieveTests = []struct {
 	area      string
 	env       *Envelope
 	body      string
+	attached  []string
 	wantErr   bool
 }{
 	{
@@ -165,9 +168,11 @@ var retrieveTests = []struct {
 			Autoresponse:    true,
 			BBSReceivedDate: time.Date(2021, 12, 1, 8, 4, 29, 0, time.Local),
 			NotPlainText:    true,
+			Charset:         "us-ascii",
 			SubjectLine:     "Undeliverable: SERV Volunteer Hours for November 2021",
 		},
-		body: expectedBounceBody,
+		body:     expectedBounceBody,
+		attached: []string{"ATT00001 message/delivery-status", "attachment2.eml message/rfc822"},
 	},
 	{
 		name:      "no plain text",
@@ -188,6 +193,7 @@ var retrieveTests = []struct {
 			ReceivedBBS:  "bbs",
 			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
 			NotPlainText: true,
+			Charset:      "us-ascii",
 		},
 		body: "nothing\n",
 	},
@@ -199,6 +205,7 @@ var retrieveTests = []struct {
 			ReceivedBBS:  "bbs",
 			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
 			NotPlainText: true,
+			Charset:      "us-ascii",
 		},
 		body: "nothing\n",
 	},
@@ -231,6 +238,7 @@ var retrieveTests = []struct {
 			ReceivedBBS:  "bbs",
 			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
 			NotPlainText: true,
+			Charset:      "us-ascii",
 		},
 		body: "nothing\n",
 	},
@@ -242,6 +250,7 @@ var retrieveTests = []struct {
 			ReceivedBBS:  "bbs",
 			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
 			NotPlainText: true,
+			Charset:      "us-ascii",
 		},
 		body: "nothing\n",
 	},
@@ -252,9 +261,36 @@ var retrieveTests = []struct {
 		env: &Envelope{
 			ReceivedBBS:  "bbs",
 			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+			Charset:      "us-ascii",
 		},
 		wantErr: true,
 	},
+	{
+		name:      "multipart with attachment",
+		retrieved: "Content-Type: multipart/mixed; boundary=\"X\"\n\n\n--X\nContent-Type: multipart/alternative; boundary=\"Y\"\n\n--Y\nContent-Type: text/plain\n\nnothing\n\n--Y\nContent-Type: text/html\n\n<p>nothing</p>\n\n--Y--\n\n--X\nContent-Type: image/jpeg; name=\"photo.jpg\"\nContent-Disposition: attachment\nContent-Transfer-Encoding: base64\n\n/9j/4A==\n\n--X--\n",
+		bbs:       "bbs",
+		env: &Envelope{
+			ReceivedBBS:  "bbs",
+			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+			NotPlainText: true,
+			Charset:      "us-ascii",
+		},
+		body:     "nothing\n",
+		attached: []string{"photo.jpg image/jpeg"},
+	},
+	{
+		name:      "multipart with unnamed attachments",
+		retrieved: "Content-Type: multipart/mixed; boundary=\"X\"\n\n\n--X\nContent-Type: text/plain\n\nnothing\n\n--X\nContent-Type: image/jpeg\nContent-Disposition: attachment\nContent-Transfer-Encoding: base64\n\n/9j/4A==\n\n--X\nContent-Type: text/html\nContent-Disposition: attachment\n\n<p>nothing</p>\n\n--X--\n",
+		bbs:       "bbs",
+		env: &Envelope{
+			ReceivedBBS:  "bbs",
+			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+			NotPlainText: true,
+			Charset:      "us-ascii",
+		},
+		body:     "nothing\n",
+		attached: []string{"attachment1.jpg image/jpeg", "attachment2.html text/html"},
+	},
 	{
 		name:      "multipart with no plain text",
 		retrieved: "Content-Type: multipart/alternative; boundary=\"X\"\n\n\n--X\nContent-Type: text/html\n\n<div>nothing</div>\n\n--X--\n",
@@ -275,6 +311,80 @@ var retrieveTests = []struct {
 			ReceivedDate:    time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
 			ReturnAddr:      "nobody@nowhere",
 			BBSReceivedDate: time.Date(2021, 12, 1, 8, 4, 29, 0, time.Local),
+			Charset:         "us-ascii",
+		},
+		body: "nothing\n",
+	},
+	{
+		name:      "iso-8859-1 quoted-printable",
+		retrieved: "Content-Type: text/plain; charset=ISO-8859-1\nContent-Transfer-Encoding: quoted-printable\n\nSe=F1or\n",
+		bbs:       "bbs",
+		env: &Envelope{
+			ReceivedBBS:  "bbs",
+			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+			NotPlainText: true,
+			Charset:      "iso-8859-1",
+		},
+		body: "Señor\n",
+	},
+	{
+		name:      "windows-1252 8bit",
+		retrieved: "Content-Type: text/plain; charset=windows-1252\nContent-Transfer-Encoding: 8bit\n\n\x93quoted\x94 \x80 5\n",
+		bbs:       "bbs",
+		env: &Envelope{
+			ReceivedBBS:  "bbs",
+			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+			Charset:      "windows-1252",
+		},
+		body: "“quoted” € 5\n",
+	},
+	{
+		name:      "iso-8859-15",
+		retrieved: "Content-Type: text/plain; charset=iso-8859-15\nContent-Transfer-Encoding: quoted-printable\n\n=A4 5 =E9t=E9\n",
+		bbs:       "bbs",
+		env: &Envelope{
+			ReceivedBBS:  "bbs",
+			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+			NotPlainText: true,
+			Charset:      "iso-8859-15",
+		},
+		body: "€ 5 été\n",
+	},
+	{
+		name:      "undeclared non-UTF-8",
+		retrieved: "From nobody@nowhere Wed Dec  1 08:04:29 2021\n\ncaf\xe9\n",
+		bbs:       "bbs",
+		env: &Envelope{
+			ReceivedBBS:     "bbs",
+			ReceivedDate:    time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+			ReturnAddr:      "nobody@nowhere",
+			BBSReceivedDate: time.Date(2021, 12, 1, 8, 4, 29, 0, time.Local),
+			Charset:         "windows-1252",
+		},
+		body: "café\n",
+	},
+	{
+		name:      "utf-8",
+		retrieved: "Content-Type: text/plain; charset=utf-8\nContent-Transfer-Encoding: 8bit\n\ncafé\n",
+		bbs:       "bbs",
+		env: &Envelope{
+			ReceivedBBS:  "bbs",
+			ReceivedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+			Charset:      "utf-8",
+		},
+		body: "café\n",
+	},
+	{
+		name:      "encoded subject",
+		retrieved: "From nobody@nowhere Wed Dec  1 08:04:29 2021\nSubject: =?iso-8859-1?q?Se=F1or?=\n\nnothing\n",
+		bbs:       "bbs",
+		env: &Envelope{
+			ReceivedBBS:     "bbs",
+			ReceivedDate:    time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local),
+			ReturnAddr:      "nobody@nowhere",
+			BBSReceivedDate: time.Date(2021, 12, 1, 8, 4, 29, 0, time.Local),
+			SubjectLine:     "Señor",
+			Charset:         "us-ascii",
 		},
 		body: "nothing\n",
 	},
@@ -291,6 +401,14 @@ func TestReceive(t *testing.T) {
 			if err == nil && tt.wantErr {
 				t.Fatal("unexpected success")
 			}
+			var attached []string
+			for _, a := range m.Attachments {
+				attached = append(attached, a.Filename+" "+a.MediaType)
+			}
+			if !reflect.DeepEqual(attached, tt.attached) {
+				t.Fatalf("attachments %q should be %q", attached, tt.attached)
+			}
+			m.Attachments = nil
 			if !reflect.DeepEqual(m, tt.env) {
 				spew.Fdump(os.Stderr, "actual", m)
 				spew.Fdump(os.Stderr, "expected", tt.env)
@@ -1262,3 +1380,44 @@ X-MS-Exchange-CrossTenant-Id: 63dc83d7-8dcb-489b-bce2-0bf7c37d8f39
 X-MS-Exchange-Transport-CrossTenantHeadersStamped: BY5PR09MB5379
 
 `
+
+func TestHops(t *testing.T) {
+	const retrieved = "From: <nobody@nowhere>\nDate: Fri, 15 Mar 2024 14:20:31 +0000\n\n" +
+		"R:240315/1431z @:W6XSC.#NCA.CA.USA.NOAM [San Jose] #:5678 $:1234_W1ABC\n" +
+		"R:240315/1423Z 1234@W1ABC.#NCA.CA.USA.NOAM\n\nnothing\n"
+	var expected = []Hop{
+		{BBS: "W1ABC", Time: time.Date(2024, 3, 15, 14, 23, 0, 0, time.UTC), MessageNumber: "1234"},
+		{BBS: "W6XSC", Time: time.Date(2024, 3, 15, 14, 31, 0, 0, time.UTC), MessageNumber: "5678"},
+	}
+	env, body, err := ParseRetrieved(retrieved, "W6XSC", "")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if body != "nothing\n" {
+		t.Fatalf("body %q should be %q", body, "nothing\n")
+	}
+	checkHops := func(hops []Hop) {
+		t.Helper()
+		if len(hops) != len(expected) {
+			t.Fatalf("got %d hops, expected %d", len(hops), len(expected))
+		}
+		for i, hop := range hops {
+			if hop.BBS != expected[i].BBS || !hop.Time.Equal(expected[i].Time) || hop.MessageNumber != expected[i].MessageNumber {
+				t.Errorf("hop %d is %v, expected %v", i, hop, expected[i])
+			}
+		}
+	}
+	checkHops(env.Hops)
+	if lat := env.HopLatencies(); len(lat) != 2 || lat[0] != 3*time.Minute || lat[1] != 8*time.Minute {
+		t.Errorf("hop latencies %v, expected [3m0s 8m0s]", lat)
+	}
+	if lat := env.TransitLatency(); lat != 11*time.Minute {
+		t.Errorf("transit latency %s, expected 11m0s", lat)
+	}
+	// Make sure the hops are preserved through saving.
+	env, _, err = ParseSaved(env.RenderSaved(body))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	checkHops(env.Hops)
+}
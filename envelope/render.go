@@ -27,28 +27,25 @@ func (env *Envelope) RenderSaved(body string) string {
 	if env.ReceivedArea == "" && env.Bulletin {
 		sb.WriteString("X-Packet-Bulletin: true\n")
 	}
-	if env.From != "" {
-		if addrs, err := ParseAddressList(env.From); err == nil {
-			var from = make([]string, len(addrs))
-			for i, a := range addrs {
-				from[i] = a.String()
-			}
-			fmt.Fprintf(&sb, "From: %s\n", strings.Join(from, ",\n\t"))
-		} else {
-			fmt.Fprintf(&sb, "From: %s\n", env.From)
-		}
+	if env.Priority != PriorityNormal {
+		fmt.Fprintf(&sb, "X-Packet-Priority: %s\n", env.Priority)
 	}
-	if env.To != "" {
-		if addrs, err := ParseAddressList(env.To); err == nil {
-			var to = make([]string, len(addrs))
-			for i, a := range addrs {
-				to[i] = a.String()
-			}
-			fmt.Fprintf(&sb, "To: %s\n", strings.Join(to, ",\n\t"))
-		} else {
-			fmt.Fprintf(&sb, "To: %s\n", env.To)
-		}
+	if !env.Expires.IsZero() {
+		fmt.Fprintf(&sb, "X-Packet-Expires: %s\n", env.Expires.Format(time.RFC1123Z))
 	}
+	if !env.ReplyBy.IsZero() {
+		fmt.Fprintf(&sb, "X-Packet-Reply-By: %s\n", env.ReplyBy.Format(time.RFC1123Z))
+	}
+	if env.IsReceived() && !env.ReadDate.IsZero() {
+		fmt.Fprintf(&sb, "X-Packet-Read: %s\n", env.ReadDate.Format(time.RFC1123Z))
+	}
+	for _, hop := range env.Hops {
+		fmt.Fprintf(&sb, "X-Packet-Hop: %s\n", renderHop(hop))
+	}
+	renderAddressHeader(&sb, "From", env.From)
+	renderAddressHeader(&sb, "To", env.To)
+	renderAddressHeader(&sb, "Cc", env.Cc)
+	renderAddressHeader(&sb, "Bcc", env.Bcc)
 	if env.SubjectLine != "" {
 		fmt.Fprintf(&sb, "Subject: %s\n", env.SubjectLine)
 	}
@@ -60,6 +57,18 @@ func (env *Envelope) RenderSaved(body string) string {
 	return sb.String()
 }
 
+// renderAddressHeader renders an address list header, with one address per
+// line.  If the address list can't be parsed, it is rendered as is.
+func renderAddressHeader(sb *strings.Builder, header, list string) {
+	if list == "" {
+		return
+	}
+	if formatted, err := FormatAddressList(list, ",\n\t"); err == nil {
+		list = formatted
+	}
+	fmt.Fprintf(sb, "%s: %s\n", header, list)
+}
+
 // RenderBody renders just the body part of the message according to the
 // parameters in the envelope.
 func (env *Envelope) RenderBody(body string) string {
@@ -70,18 +79,7 @@ func (env *Envelope) RenderBody(body string) string {
 		}
 		return body
 	}
-	var sb strings.Builder
-	if env.OutpostUrgent {
-		sb.WriteString("!URG!")
-	}
-	if env.RequestDeliveryReceipt {
-		sb.WriteString("!RDR!")
-	}
-	if env.RequestReadReceipt {
-		sb.WriteString("!RRR!")
-	}
-	sb.WriteString(body)
-	body = sb.String()
+	body = env.outpostCodes() + body
 	if needB64 {
 		return "!B64!" + base64.StdEncoding.EncodeToString([]byte(body)) + "\n"
 	}
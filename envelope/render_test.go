@@ -1,7 +1,9 @@
 package envelope
 
 import (
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEncodeReceived(t *testing.T) {
@@ -35,3 +37,80 @@ func TestEncodeOutpostB64(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestEncodeCcBcc(t *testing.T) {
+	const start = "From: Nobody <nobody@nowhere>\nTo: Somebody <somebody@somewhere>\nCc: Number Two <number2@somewhere>,\n\tNumber Three <number3@somewhere>\nBcc: Number Four <number4@somewhere>\nSubject: Hello, World\n\nnothing\n"
+	var env, body, _ = ParseSaved(start)
+	if env.Recipients() != "Somebody <somebody@somewhere>, Number Two <number2@somewhere>, Number Three <number3@somewhere>, Number Four <number4@somewhere>" {
+		t.Errorf("incorrect recipients %q", env.Recipients())
+	}
+	var end = env.RenderSaved(body)
+	if start != end {
+		t.Fatalf("actual:\n%s\nexpected:\n%s\n", end, start)
+	}
+}
+
+func TestRenderMIME(t *testing.T) {
+	var env = Envelope{From: "nobody@w6xsc.ampr.org", To: "Somebody <somebody@example.com>", Bcc: "Hidden <hidden@w6xsc.ampr.org>", SubjectLine: "Héllo", RequestDeliveryReceipt: true}
+	var pdf = []byte("%PDF-1.4 not really")
+	var rendered = env.RenderMIME("Grüße\nline 2\n", Attachment{Filename: "form.pdf", Data: pdf})
+	if !strings.Contains(rendered, "Content-Type: text/plain; charset=utf-8\r\n") || !strings.Contains(rendered, "filename=form.pdf") {
+		t.Errorf("missing part headers:\n%s", rendered)
+	}
+	if strings.Contains(rendered, "Bcc") || strings.Contains(rendered, "hidden@") {
+		t.Errorf("Bcc rendered in MIME headers:\n%s", rendered)
+	}
+	renv, body, err := ParseRetrieved(rendered, "bbs", "")
+	if err != nil {
+		t.Fatalf("unexpected error %s", err)
+	}
+	if body = strings.ReplaceAll(body, "\r\n", "\n"); body != "Grüße\nline 2\n" {
+		t.Errorf("body %q should be %q", body, "Grüße\nline 2\n")
+	}
+	if !strings.Contains(rendered, "Subject: =?utf-8?q?H=C3=A9llo?=\r\n") {
+		t.Errorf("subject not encoded:\n%s", rendered)
+	}
+	if !renv.RequestDeliveryReceipt || renv.To != env.To {
+		t.Errorf("envelope not preserved: %+v", renv)
+	}
+	if plain, gateway := env.MIMERecipients(); len(plain) != 1 || plain[0] != "hidden@w6xsc.ampr.org" || len(gateway) != 1 || gateway[0] != "somebody@example.com" {
+		t.Errorf("MIMERecipients returned %v, %v", plain, gateway)
+	}
+}
+
+func TestEncodePriorityExpiry(t *testing.T) {
+	const start = "X-Packet-Queued: true\nX-Packet-Priority: high\nX-Packet-Expires: Wed, 01 Dec 2021 10:00:00 +0000\nX-Packet-Reply-By: Wed, 01 Dec 2021 12:00:00 +0000\nTo: somebody\nSubject: Hello, World\n\nnothing\n"
+	var env, body, err = ParseSaved(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.Priority != PriorityHigh || env.Expires.IsZero() || env.ReplyBy.IsZero() {
+		t.Errorf("headers not parsed: %+v", env)
+	}
+	if end := env.RenderSaved(body); start != end {
+		t.Fatalf("actual:\n%s\nexpected:\n%s\n", end, start)
+	}
+	defer func() { now = time.Now }()
+	now = func() time.Time { return time.Date(2021, 12, 1, 9, 59, 0, 0, time.UTC) }
+	if err := env.CheckSend(); err != nil {
+		t.Errorf("unexpired message: %s", err)
+	}
+	now = func() time.Time { return time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC) }
+	if err := env.CheckSend(); err != ErrExpired {
+		t.Errorf("expired message: got %v, expected ErrExpired", err)
+	}
+}
+
+func TestEncodeReadDate(t *testing.T) {
+	const start = "Received: FROM w1xsc.ampr.org BY pktmsg.local; Wed, 01 Dec 2021 08:04:29 +0000\nX-Packet-Read: Wed, 01 Dec 2021 09:00:00 +0000\nFrom: somebody\nTo: nobody\nSubject: Hello, World\n\nnothing\n"
+	var env, body, err = ParseSaved(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !env.ReadDate.Equal(time.Date(2021, 12, 1, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("read date not parsed: %v", env.ReadDate)
+	}
+	if end := env.RenderSaved(body); start != end {
+		t.Fatalf("actual:\n%s\nexpected:\n%s\n", end, start)
+	}
+}
@@ -3,6 +3,7 @@ module github.com/rothskeller/packet
 go 1.21
 
 require (
+	github.com/boombuler/barcode v1.0.1
 	github.com/davecgh/go-spew v1.1.1
 	github.com/rothskeller/gofpdf v1.4.11
 	github.com/rothskeller/gofpdi v1.0.23
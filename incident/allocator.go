@@ -0,0 +1,225 @@
+package incident
+
+// This file contains the persistent message number allocator.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrExhausted is returned by Allocator methods when the block of message
+// numbers assigned to the allocator has been used up.
+var ErrExhausted = errors.New("assigned block of message numbers exhausted")
+
+// msgIDPrefixRE matches a valid message ID prefix.  It must agree with MsgIDRE.
+var msgIDPrefixRE = regexp.MustCompile(`^(?:[0-9][A-Z]{2}|[A-Z][A-Z0-9]{2})$`)
+
+// An Allocator issues message numbers from persistent counters, one for each
+// message ID prefix.  Unlike UniqueMessageID, it never issues the same number
+// twice, even if the message that had it is removed, and a single Allocator
+// can be shared by multiple incidents (and multiple processes) so that a
+// station's message numbers don't repeat across incidents.
+//
+// An Allocator can also reserve a block of numbers, to be assigned to another
+// Allocator (e.g., on a laptop that will be used offline).  An Allocator with
+// an assigned block issues numbers only from that block.
+//
+// The counters are stored in a text file, with one line per prefix:
+//
+//	«prefix» «next» [«last»]
+//
+// where «next» is the next number to be issued and «last», if present, is the
+// last number in the assigned block.
+type Allocator struct {
+	filename string
+}
+
+// allocCounter is the state of an Allocator for one prefix.
+type allocCounter struct {
+	next int
+	last int // zero if no block is assigned
+}
+
+// NewAllocator returns an Allocator whose counters are stored in the named
+// file.  The file is created when the first number is issued.
+func NewAllocator(filename string) *Allocator {
+	return &Allocator{filename: filename}
+}
+
+// Next issues the next message number for the specified prefix, which must be
+// a valid message ID prefix.  The number is at least floor (which can be used
+// to start the numbering at something other than 1), and is greater than any
+// number previously issued or reserved for that prefix.
+func (a *Allocator) Next(prefix string, floor int) (seq int, err error) {
+	err = a.update(prefix, func(c *allocCounter) error {
+		c.next = max(c.next, floor, 1)
+		if c.last != 0 && c.next > c.last {
+			return ErrExhausted
+		}
+		seq = c.next
+		c.next++
+		return nil
+	})
+	return seq, err
+}
+
+// Reserve reserves a block of count consecutive message numbers for the
+// specified prefix, and returns the first and last numbers in the block.  None
+// of them will be issued by this Allocator.  They can be assigned to another
+// Allocator with Assign.
+func (a *Allocator) Reserve(prefix string, count int) (first, last int, err error) {
+	if count < 1 {
+		return 0, 0, errors.New("invalid count")
+	}
+	err = a.update(prefix, func(c *allocCounter) error {
+		c.next = max(c.next, 1)
+		if c.last != 0 && c.next+count-1 > c.last {
+			return ErrExhausted
+		}
+		first, last = c.next, c.next+count-1
+		c.next += count
+		return nil
+	})
+	return first, last, err
+}
+
+// Assign restricts the Allocator to issuing numbers for the specified prefix
+// from the block first through last, which was presumably reserved from
+// another Allocator with Reserve.  It returns an error if the Allocator has
+// already issued numbers in or after that block.
+func (a *Allocator) Assign(prefix string, first, last int) (err error) {
+	if first < 1 || last < first {
+		return errors.New("invalid block")
+	}
+	return a.update(prefix, func(c *allocCounter) error {
+		if c.next > first {
+			return fmt.Errorf("numbers through %s-%03d have already been issued", prefix, c.next-1)
+		}
+		c.next, c.last = first, last
+		return nil
+	})
+}
+
+// update locks the counter file, reads it, applies fn to the counter for the
+// specified prefix, and writes it back if fn succeeds.
+func (a *Allocator) update(prefix string, fn func(*allocCounter) error) (err error) {
+	var (
+		unlock   func()
+		counters map[string]*allocCounter
+	)
+	if !msgIDPrefixRE.MatchString(prefix) {
+		return fmt.Errorf("invalid message ID prefix %q", prefix)
+	}
+	if unlock, err = lockFile(a.filename + ".lock"); err != nil {
+		return err
+	}
+	defer unlock()
+	if counters, err = a.read(); err != nil {
+		return err
+	}
+	if counters[prefix] == nil {
+		counters[prefix] = new(allocCounter)
+	}
+	if err = fn(counters[prefix]); err != nil {
+		return err
+	}
+	return a.write(counters)
+}
+
+// read reads the counter file.  A nonexistent file is treated as empty.
+func (a *Allocator) read() (counters map[string]*allocCounter, err error) {
+	var data []byte
+
+	counters = make(map[string]*allocCounter)
+	if data, err = os.ReadFile(a.filename); errors.Is(err, fs.ErrNotExist) {
+		return counters, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for i, line := range strings.Split(string(data), "\n") {
+		var (
+			c      allocCounter
+			fields = strings.Fields(line)
+		)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 3 || !msgIDPrefixRE.MatchString(fields[0]) {
+			return nil, fmt.Errorf("%s:%d: invalid line", a.filename, i+1)
+		}
+		if len(fields) > 1 {
+			if c.next, err = strconv.Atoi(fields[1]); err != nil || c.next < 1 {
+				return nil, fmt.Errorf("%s:%d: invalid next number", a.filename, i+1)
+			}
+		}
+		if len(fields) > 2 {
+			if c.last, err = strconv.Atoi(fields[2]); err != nil || c.last < 1 {
+				return nil, fmt.Errorf("%s:%d: invalid last number", a.filename, i+1)
+			}
+		}
+		counters[fields[0]] = &c
+	}
+	return counters, nil
+}
+
+// write writes the counter file.  It writes a temporary file and renames it
+// into place, so that a crash can't lose the counters.
+func (a *Allocator) write(counters map[string]*allocCounter) error {
+	var (
+		prefixes []string
+		sb       strings.Builder
+	)
+	for prefix := range counters {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		if c := counters[prefix]; c.last != 0 {
+			fmt.Fprintf(&sb, "%s %d %d\n", prefix, c.next, c.last)
+		} else {
+			fmt.Fprintf(&sb, "%s %d\n", prefix, c.next)
+		}
+	}
+	return replaceFile(a.filename, []byte(sb.String()))
+}
+
+// SetAllocator sets the Allocator from which the incident takes the numbers
+// for new LMIs assigned by NewMessageID (and therefore by ReceiveMessage,
+// ImportMbox, and ImportOutpost).  If it is nil (the default), NewMessageID
+// uses UniqueMessageID instead.
+func (inc *Incident) SetAllocator(alloc *Allocator) { inc.alloc = alloc }
+
+// NewMessageID returns a new message ID with the same prefix and suffix as id,
+// for a new message.  If the incident has an Allocator, the sequence number is
+// issued by it, starting no lower than the sequence number in id; numbers that
+// are already used in the incident are skipped.  Otherwise, NewMessageID
+// returns UniqueMessageID(id).
+func (inc *Incident) NewMessageID(id string) (lmi string, err error) {
+	var (
+		match = MsgIDRE.FindStringSubmatch(id)
+		floor int
+	)
+	if match == nil {
+		return "", fmt.Errorf("invalid message ID %q", id)
+	}
+	if inc.alloc == nil {
+		return inc.UniqueMessageID(id), nil
+	}
+	floor, _ = strconv.Atoi(match[2])
+	for {
+		var seq int
+
+		if seq, err = inc.alloc.Next(match[1], floor); err != nil {
+			return "", err
+		}
+		if lmi = fmt.Sprintf("%s-%03d%s", match[1], seq, match[3]); inc.UniqueMessageID(lmi) == lmi {
+			return lmi, nil
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package incident
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/xscmsg/plaintext"
+)
+
+// saveAllocatedMessage saves a new outgoing message with an LMI allocated from
+// msgid by NewMessageID, and returns the LMI.
+func saveAllocatedMessage(inc *Incident, msgid string) (lmi string, err error) {
+	err = inc.WithLock(func(inc *Incident) error {
+		var (
+			env = &envelope.Envelope{From: "a@b", To: "c@d", Date: time.Now()}
+			msg = plaintext.New()
+		)
+		if lmi, err = inc.NewMessageID(msgid); err != nil {
+			return err
+		}
+		env.SubjectLine = lmi + "_R_test"
+		return inc.SaveMessage(lmi, "", env, msg, true, true)
+	})
+	return lmi, err
+}
+
+func TestAllocator(t *testing.T) {
+	var (
+		filename = filepath.Join(t.TempDir(), "msgnums")
+		alloc    = NewAllocator(filename)
+	)
+	for _, tt := range []struct {
+		prefix string
+		floor  int
+		seq    int
+	}{
+		{"XND", 0, 1},
+		{"XND", 0, 2},
+		{"XND", 100, 100},
+		{"XND", 0, 101},
+		{"6AB", 5, 5},
+		{"XND", 0, 102},
+	} {
+		if seq, err := alloc.Next(tt.prefix, tt.floor); err != nil || seq != tt.seq {
+			t.Errorf("Next(%s, %d) = %d, %v; expected %d", tt.prefix, tt.floor, seq, err, tt.seq)
+		}
+	}
+	if _, err := alloc.Next("XN-", 0); err == nil {
+		t.Error("Next with invalid prefix succeeded")
+	}
+	// A new Allocator on the same file continues where the old one left
+	// off.
+	alloc = NewAllocator(filename)
+	first, last, err := alloc.Reserve("XND", 3)
+	if err != nil || first != 103 || last != 105 {
+		t.Errorf("Reserve = %d, %d, %v; expected 103, 105", first, last, err)
+	}
+	if seq, err := alloc.Next("XND", 0); err != nil || seq != 106 {
+		t.Errorf("Next after Reserve = %d, %v; expected 106", seq, err)
+	}
+	// An Allocator with an assigned block issues only from that block.
+	offline := NewAllocator(filepath.Join(t.TempDir(), "msgnums"))
+	if err = offline.Assign("XND", first, last); err != nil {
+		t.Fatal(err)
+	}
+	for seq := first; seq <= last; seq++ {
+		if got, err := offline.Next("XND", 0); err != nil || got != seq {
+			t.Errorf("offline Next = %d, %v; expected %d", got, err, seq)
+		}
+	}
+	if _, err = offline.Next("XND", 0); !errors.Is(err, ErrExhausted) {
+		t.Errorf("offline Next after block = %v; expected ErrExhausted", err)
+	}
+	if err = alloc.Assign("XND", 1, 10); err == nil {
+		t.Error("Assign of already issued numbers succeeded")
+	}
+}
+
+func TestNewMessageIDNeverReissues(t *testing.T) {
+	inc := New(NewMemoryStore())
+	inc.SetAllocator(NewAllocator(filepath.Join(t.TempDir(), "msgnums")))
+	lmi, err := saveAllocatedMessage(inc, "XND-001P")
+	if err != nil || lmi != "XND-001P" {
+		t.Fatalf("first message = %s, %v", lmi, err)
+	}
+	// An existing message that the allocator didn't issue is skipped.
+	if _, err = saveNewMessage(New(inc.store), "XND-002P"); err != nil {
+		t.Fatal(err)
+	}
+	inc.RemoveMessage("XND-001P")
+	if lmi, err = inc.NewMessageID("XND-001P"); err != nil || lmi != "XND-003P" {
+		t.Errorf("NewMessageID = %s, %v; expected XND-003P", lmi, err)
+	}
+}
+
+func TestAllocatorConcurrent(t *testing.T) {
+	const workers, count = 8, 10
+	var (
+		alloc = NewAllocator(filepath.Join(t.TempDir(), "msgnums"))
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		lmis  = make(map[string]bool)
+	)
+	// Two incidents share the allocator, so their LMIs must not collide
+	// even though neither can see the other's messages.
+	incs := []*Incident{New(NewMemoryStore()), New(NewMemoryStore())}
+	for _, inc := range incs {
+		inc.SetAllocator(alloc)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(inc *Incident) {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				lmi, err := saveAllocatedMessage(inc, "XND-001P")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if lmis[lmi] {
+					t.Errorf("LMI %s allocated twice", lmi)
+				}
+				lmis[lmi] = true
+				mu.Unlock()
+			}
+		}(incs[w%len(incs)])
+	}
+	wg.Wait()
+	if len(lmis) != workers*count {
+		t.Errorf("got %d LMIs, expected %d", len(lmis), workers*count)
+	}
+}
@@ -0,0 +1,224 @@
+package incident
+
+// This file contains the incident consistency checker.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+)
+
+// A Problem describes an inconsistency in an incident, found by Check.
+type Problem struct {
+	// Name is the name of the file with the problem.
+	Name string
+	// Problem is a description of the problem.
+	Problem string
+	// Repaired is true if Check repaired the problem.
+	Repaired bool
+}
+
+func (p Problem) String() string {
+	if p.Repaired {
+		return fmt.Sprintf("%s: %s (repaired)", p.Name, p.Problem)
+	}
+	return fmt.Sprintf("%s: %s", p.Name, p.Problem)
+}
+
+// Check scans the incident for inconsistencies and returns a list of the
+// problems it finds.  It looks for:
+//   - message and receipt files that cannot be parsed;
+//   - receipts for messages that don't exist;
+//   - PDF renderings of messages that don't exist, or that are older than
+//     the message they render;
+//   - ICS-309 logs that are older than some message;
+//   - symbolic links (or RMI index entries) that refer to messages or PDFs
+//     that don't exist.
+//
+// If repair is true, Check also repairs the problems it can:  orphaned PDFs,
+// stale ICS-309 logs, and dangling links and index entries are removed, and
+// stale PDFs are regenerated (or removed, if they cannot be).  Orphaned
+// receipts are not removed, since they may be the only record of a delivery;
+// they are renamed with an added ".orphan" suffix, so that they are no longer
+// treated as receipts.  Unparseable files are never changed.  An error is returned only if the
+// incident cannot be read.
+func (inc *Incident) Check(repair bool) (problems []Problem, err error) {
+	var (
+		entries []StoreEntry
+		files   = make(map[string]StoreEntry)
+		latest  time.Time
+		unlock  func()
+	)
+	if inc, unlock, err = inc.lock(); err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if entries, err = inc.store.List(); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		files[entry.Name] = entry
+	}
+	report := func(name, problem string, fix func() error) {
+		var p = Problem{Name: name, Problem: problem}
+		if repair && fix != nil {
+			p.Repaired = fix() == nil
+		}
+		problems = append(problems, p)
+	}
+	// Check the regular files first, so that any links to files removed
+	// during repair are themselves caught afterward.
+	for _, entry := range entries {
+		var name = entry.Name
+
+		if entry.Link != "" || name == rmiIndexFile {
+			continue
+		}
+		switch {
+		case receiptExtRE.MatchString(name):
+			lmi := name[:receiptExtRE.FindStringIndex(name)[0]]
+			if !MsgIDRE.MatchString(lmi) {
+				continue
+			}
+			if latest.Before(entry.ModTime) {
+				latest = entry.ModTime
+			}
+			if parent, ok := files[lmi+".txt"]; !ok || parent.Link != "" {
+				report(name, "receipt for nonexistent message "+lmi, func() error { return inc.quarantine(name) })
+				continue
+			}
+			if problem := inc.checkParse(name); problem != "" {
+				report(name, problem, nil)
+			}
+		case strings.HasSuffix(name, ".txt"):
+			if !MsgIDRE.MatchString(name[:len(name)-4]) {
+				continue
+			}
+			if latest.Before(entry.ModTime) {
+				latest = entry.ModTime
+			}
+			if problem := inc.checkParse(name); problem != "" {
+				report(name, problem, nil)
+			}
+		case strings.HasSuffix(name, ".pdf"):
+			lmi := name[:len(name)-4]
+			if !MsgIDRE.MatchString(lmi) {
+				continue
+			}
+			if parent, ok := files[lmi+".txt"]; !ok || parent.Link != "" {
+				report(name, "PDF for nonexistent message "+lmi, func() error { return inc.store.Remove(name) })
+			} else if entry.ModTime.Before(parent.ModTime) {
+				report(name, "PDF is older than message", func() error { return inc.rerenderPDF(lmi) })
+			}
+		}
+	}
+	// Check for stale ICS-309 logs.
+	for _, name := range []string{"ics309.csv", "ics309.pdf"} {
+		if entry, ok := files[name]; ok && entry.ModTime.Before(latest) {
+			report(name, "ICS-309 log is older than messages", func() error { return inc.store.Remove(name) })
+		}
+	}
+	// Check for dangling links.
+	for _, entry := range entries {
+		var name = entry.Name
+
+		if entry.Link == "" {
+			continue
+		}
+		if target, err := inc.store.Stat(entry.Link); err != nil || target.Link != "" {
+			report(name, "link to nonexistent "+entry.Link, func() error { return inc.store.Remove(name) })
+		}
+	}
+	// Check the RMI index, if any.
+	if _, ok := files[rmiIndexFile]; ok {
+		problems = append(problems, inc.checkRMIIndex(repair)...)
+	}
+	return problems, nil
+}
+
+// checkParse returns a description of the problem if the named message or
+// receipt file cannot be parsed, or "" if it can.
+func (inc *Incident) checkParse(name string) string {
+	contents, err := inc.store.ReadFile(name)
+	if err != nil {
+		return err.Error()
+	}
+	if _, _, err = envelope.ParseSaved(string(contents)); err != nil {
+		return "stored message could not be parsed: " + err.Error()
+	}
+	return ""
+}
+
+// quarantine renames an orphaned receipt file with an added ".orphan" suffix
+// (and a number, if needed to make it unique).
+func (inc *Incident) quarantine(name string) (err error) {
+	var (
+		contents []byte
+		qname    = name + ".orphan"
+	)
+	if contents, err = inc.store.ReadFile(name); err != nil {
+		return err
+	}
+	for seq := 2; ; seq++ {
+		if _, err = inc.store.Stat(qname); errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		qname = fmt.Sprintf("%s.orphan%d", name, seq)
+	}
+	if err = inc.store.WriteFile(qname, contents); err != nil {
+		return err
+	}
+	return inc.store.Remove(name)
+}
+
+// rerenderPDF regenerates the PDF rendering of a message.  If the message can
+// no longer be rendered, its stale PDF is removed instead.
+func (inc *Incident) rerenderPDF(lmi string) (err error) {
+	env, msg, err := inc.ReadMessage(lmi)
+	if err == nil {
+		if err = inc.renderPDF(env, msg, lmi+".pdf"); err == nil {
+			return nil
+		}
+	}
+	return inc.store.Remove(lmi + ".pdf")
+}
+
+// checkRMIIndex checks the RMI index for entries referring to nonexistent
+// messages, and removes them if repair is true.
+func (inc *Incident) checkRMIIndex(repair bool) (problems []Problem) {
+	var (
+		index map[string]string
+		rmis  []string
+		err   error
+	)
+	if index, err = inc.readRMIIndex(); err != nil {
+		return []Problem{{Name: rmiIndexFile, Problem: err.Error()}}
+	}
+	for rmi, lmi := range index {
+		if entry, err := inc.store.Stat(lmi + ".txt"); err != nil || entry.Link != "" {
+			rmis = append(rmis, rmi)
+		}
+	}
+	if len(rmis) == 0 {
+		return nil
+	}
+	sort.Strings(rmis)
+	for _, rmi := range rmis {
+		problems = append(problems, Problem{
+			Name:    rmiIndexFile,
+			Problem: fmt.Sprintf("entry for %s refers to nonexistent message %s", rmi, index[rmi]),
+		})
+		delete(index, rmi)
+	}
+	if repair && inc.writeRMIIndex(index) == nil {
+		for i := range problems {
+			problems[i].Repaired = true
+		}
+	}
+	return problems
+}
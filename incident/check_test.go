@@ -0,0 +1,177 @@
+package incident
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/xscmsg/plaintext"
+)
+
+// stubPlainPDF replaces the plain text PDF renderer with one that writes a
+// recognizable fake PDF, so that PDF regeneration can be tested without PDF
+// support built in.  It returns a function that restores the original.
+func stubPlainPDF() (restore func()) {
+	var saved = plaintext.RenderPlainPDF
+
+	plaintext.RenderPlainPDF = func(_ *envelope.Envelope, _, _, _, filename string) error {
+		return os.WriteFile(filename, []byte("regenerated"), 0644)
+	}
+	return func() { plaintext.RenderPlainPDF = saved }
+}
+
+// listFiles returns the names of the files in the store, omitting lock files.
+func listFiles(t *testing.T, store Store) (names []string) {
+	entries, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name, ".") {
+			names = append(names, entry.Name)
+		}
+	}
+	return names
+}
+
+// checkStrings runs Check and returns its problems as sorted strings.
+func checkStrings(t *testing.T, inc *Incident, repair bool) (problems []string) {
+	list, err := inc.Check(repair)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range list {
+		problems = append(problems, p.String())
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// setupCheck populates an incident with one good message (XND-001P, with RMI
+// AAA-001P) and one instance of each problem class that Check repairs.
+func setupCheck(t *testing.T, inc *Incident) {
+	var (
+		env = &envelope.Envelope{From: "a@b", To: "c@d", Date: time.Now()}
+		msg = plaintext.New().(*plaintext.PlainText)
+	)
+	msg.Subject, msg.Handling, msg.Body = "Hello", "ROUTINE", "Hello, world."
+	if err := inc.SaveMessage("XND-001P", "AAA-001P", env, msg, true, false); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"XND-001P.pdf":    "stale",
+		"XND-008P.pdf":    "orphan",
+		"XND-009P.DR.txt": "orphan",
+		"ics309.csv":      "stale",
+	} {
+		if err := inc.store.WriteFile(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := inc.store.Link("XND-007P.txt", "BBB-001P.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// Rewrite the message so that its PDF and the ICS-309 are stale.
+	time.Sleep(10 * time.Millisecond)
+	data, err := inc.store.ReadFile("XND-001P.txt")
+	if err == nil {
+		err = inc.store.WriteFile("XND-001P.txt", data)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testCheck(t *testing.T, store Store) {
+	defer stubPlainPDF()()
+	inc := New(store)
+	setupCheck(t, inc)
+	want := []string{
+		"BBB-001P.txt: link to nonexistent XND-007P.txt",
+		"XND-001P.pdf: PDF is older than message",
+		"XND-008P.pdf: PDF for nonexistent message XND-008P",
+		"XND-009P.DR.txt: receipt for nonexistent message XND-009P",
+		"ics309.csv: ICS-309 log is older than messages",
+	}
+	// Without repair, the problems are reported and nothing is changed.
+	before := listFiles(t, store)
+	if got := checkStrings(t, inc, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check(false) = %q, want %q", got, want)
+	}
+	if after := listFiles(t, store); !reflect.DeepEqual(after, before) {
+		t.Errorf("Check(false) changed files from %q to %q", before, after)
+	}
+	if data, _ := store.ReadFile("XND-001P.pdf"); string(data) != "stale" {
+		t.Errorf("Check(false) changed XND-001P.pdf to %q", data)
+	}
+	// With repair, the same problems are reported as repaired.
+	for i := range want {
+		want[i] += " (repaired)"
+	}
+	if got := checkStrings(t, inc, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("Check(true) = %q, want %q", got, want)
+	}
+	wantFiles := []string{"AAA-001P.txt", "XND-001P.pdf", "XND-001P.txt", "XND-009P.DR.txt.orphan", searchIndexFile}
+	if after := listFiles(t, store); !reflect.DeepEqual(after, wantFiles) {
+		t.Errorf("after repair, files are %q, want %q", after, wantFiles)
+	}
+	if data, _ := store.ReadFile("XND-009P.DR.txt.orphan"); string(data) != "orphan" {
+		t.Errorf("orphaned receipt not preserved: %q", data)
+	}
+	if data, _ := store.ReadFile("XND-001P.pdf"); string(data) != "regenerated" {
+		t.Errorf("stale PDF not regenerated: %q", data)
+	}
+	// Once repaired, there are no more problems.
+	if got := checkStrings(t, inc, false); len(got) != 0 {
+		t.Errorf("Check after repair = %q", got)
+	}
+}
+
+func TestCheckMemory(t *testing.T) { testCheck(t, NewMemoryStore()) }
+func TestCheckFS(t *testing.T)     { testCheck(t, NewFSStore(t.TempDir())) }
+
+func testCheckRMIIndex(t *testing.T, store Store) {
+	inc := New(store)
+	setupCheck(t, inc)
+	if err := inc.ConvertLayout(IndexLayout); err != nil {
+		t.Fatal(err)
+	}
+	if err := inc.indexRMI("CCC-001P", "XND-006P"); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, p := range checkStrings(t, inc, false) {
+		if strings.HasPrefix(p, rmiIndexFile) {
+			got = append(got, p)
+		}
+	}
+	// The dangling BBB-001P link was converted into a dangling index
+	// entry.
+	want := []string{
+		rmiIndexFile + ": entry for BBB-001P refers to nonexistent message XND-007P",
+		rmiIndexFile + ": entry for CCC-001P refers to nonexistent message XND-006P",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check(false) = %q, want %q", got, want)
+	}
+	if inc.LMIForRMI("CCC-001P") != "XND-006P" {
+		t.Error("Check(false) changed the RMI index")
+	}
+	checkStrings(t, inc, true)
+	if inc.LMIForRMI("BBB-001P") != "" || inc.LMIForRMI("CCC-001P") != "" {
+		t.Error("Check(true) did not remove the index entries")
+	}
+	if inc.LMIForRMI("AAA-001P") != "XND-001P" {
+		t.Error("Check(true) removed a good index entry")
+	}
+	if got := checkStrings(t, inc, false); len(got) != 0 {
+		t.Errorf("Check after repair = %q", got)
+	}
+}
+
+func TestCheckRMIIndexMemory(t *testing.T) { testCheckRMIIndex(t, NewMemoryStore()) }
+func TestCheckRMIIndexFS(t *testing.T)     { testCheckRMIIndex(t, NewFSStore(t.TempDir())) }
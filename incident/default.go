@@ -0,0 +1,146 @@
+package incident
+
+// This file contains the package-level functions, which operate on the
+// incident in the current working directory.  Each is a wrapper around the
+// corresponding Incident method; see the method for documentation.
+
+import (
+	"io"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+)
+
+// Default is the Incident for the current working directory, on which the
+// package-level functions operate.  It has no Allocator, so NewMessageID (and
+// therefore ReceiveMessage, ImportMbox, and ImportOutpost) uses
+// UniqueMessageID, which can reissue the number of a removed message.  Call
+// SetAllocator to opt in to never reissuing numbers.
+var Default = New(NewFSStore("."))
+
+// MessageExists returns true if a message exists with the specified LMI.
+func MessageExists(lmi string) bool { return Default.MessageExists(lmi) }
+
+// LMIForRMI returns the LMI for the message with the given RMI, if any.
+func LMIForRMI(rmi string) string { return Default.LMIForRMI(rmi) }
+
+// ReadMessage reads a message from the incident directory and returns it.
+func ReadMessage(lmi string) (env *envelope.Envelope, msg message.Message, err error) {
+	return Default.ReadMessage(lmi)
+}
+
+// ReadReceipt reads a receipt for a message.
+func ReadReceipt(lmi, rcpt string) (env *envelope.Envelope, msg message.Message, err error) {
+	return Default.ReadReceipt(lmi, rcpt)
+}
+
+// SaveMessage saves a (non-receipt) message to the incident directory.
+func SaveMessage(lmi, rmi string, env *envelope.Envelope, msg message.Message, fast, rawsubj bool) (err error) {
+	return Default.SaveMessage(lmi, rmi, env, msg, fast, rawsubj)
+}
+
+// Attachments returns the names of the files in which the attachments of the
+// message with the specified LMI are saved.
+func Attachments(lmi string) (filenames []string, err error) { return Default.Attachments(lmi) }
+
+// SaveReceipt saves a receipt message to the incident directory.
+func SaveReceipt(lmi string, env *envelope.Envelope, msg message.Message) (err error) {
+	return Default.SaveReceipt(lmi, env, msg)
+}
+
+// RemoveMessage removes the message with the specified LMI.
+func RemoveMessage(lmi string) { Default.RemoveMessage(lmi) }
+
+// UniqueMessageID returns a message ID, based on the provided one, that is not
+// in use in the incident directory.
+func UniqueMessageID(id string) string { return Default.UniqueMessageID(id) }
+
+// AllLMIs returns a list of local message IDs of all messages in the directory.
+func AllLMIs() (lmis []string, err error) { return Default.AllLMIs() }
+
+// SeqToLMI takes a sequence number and expands it to a list of existing message
+// LMIs with that sequence number.
+func SeqToLMI(seq int, remote bool) (lmis []string, err error) { return Default.SeqToLMI(seq, remote) }
+
+// Deliveries returns the delivery information for an outgoing message.
+func Deliveries(lmi string) (delivs []*DeliveryInfo, err error) { return Default.Deliveries(lmi) }
+
+// GenerateICS309 generates an ICS-309 communications log covering all of the
+// messages in the directory.
+func GenerateICS309(header *ICS309Header) (err error) { return Default.GenerateICS309(header) }
+
+// RemoveICS309s removes the generated ICS-309 log files, if any.
+func RemoveICS309s() { Default.RemoveICS309s() }
+
+// ReceiveMessage takes a raw message received from JNOS and saves it in the
+// incident.
+func ReceiveMessage(raw, bbs, area, msgid, opcall, opname string) (
+	lmi string, env *envelope.Envelope, msg message.Message, oenv *envelope.Envelope, omsg message.Message, err error,
+) {
+	return Default.ReceiveMessage(raw, bbs, area, msgid, opcall, opname)
+}
+
+// MarkRead records that the received message with the specified LMI has been
+// read by an operator, and returns a read receipt to send if one is needed.
+func MarkRead(lmi string) (oenv *envelope.Envelope, omsg message.Message, err error) {
+	return Default.MarkRead(lmi)
+}
+
+// ImportMbox imports all of the messages in the supplied mbox file into the
+// incident.
+func ImportMbox(r io.Reader, bbs, msgid string) (lmis []string, err error) {
+	return Default.ImportMbox(r, bbs, msgid)
+}
+
+// ExportMbox writes all of the messages in the incident to the supplied writer
+// in mbox format.
+func ExportMbox(w io.Writer) (err error) { return Default.ExportMbox(w) }
+
+// ImportOutpost imports messages exported from Outpost into the incident.
+func ImportOutpost(filenames []string, bbs, msgid string) (lmis []string, err error) {
+	return Default.ImportOutpost(filenames, bbs, msgid)
+}
+
+// RMILayout returns the layout the incident uses for recording RMIs.
+func RMILayout() Layout { return Default.RMILayout() }
+
+// ConvertLayout converts the incident to the specified RMI layout.
+func ConvertLayout(to Layout) (err error) { return Default.ConvertLayout(to) }
+
+// Check scans the incident for inconsistencies and returns a list of the
+// problems it finds, repairing them if repair is true.
+func Check(repair bool) (problems []Problem, err error) { return Default.Check(repair) }
+
+// WithLock calls fn with the incident locked against changes by other
+// goroutines and processes.
+func WithLock(fn func(inc *Incident) error) (err error) { return Default.WithLock(fn) }
+
+// SetAllocator sets the Allocator from which the incident takes the numbers for
+// new LMIs.  Default has none until this is called.
+func SetAllocator(alloc *Allocator) { Default.SetAllocator(alloc) }
+
+// NewMessageID returns a new message ID with the same prefix and suffix as id,
+// for a new message.
+func NewMessageID(id string) (lmi string, err error) { return Default.NewMessageID(id) }
+
+// OverdueDeliveries returns a list of the recipients of sent messages from
+// whom no delivery receipt has been received within the timeout for the
+// message's handling order.
+func OverdueDeliveries(timeouts *DeliveryTimeouts) (overdue []*OverdueDelivery, err error) {
+	return Default.OverdueDeliveries(timeouts)
+}
+
+// Thread returns the LMIs of the messages in the same thread (conversation) as
+// the message with the specified LMI, in chronological order.
+func Thread(lmi string) (lmis []string, err error) { return Default.Thread(lmi) }
+
+// Threads returns all of the threads (conversations) in the incident.
+func Threads() (threads [][]string, err error) { return Default.Threads() }
+
+// Search returns the messages (and optionally receipts) matching the query, in
+// chronological order.
+func Search(q *SearchQuery) (results []SearchResult, err error) { return Default.Search(q) }
+
+// SendQueue returns the LMIs of the outgoing messages that are queued for
+// sending, in the order they should be sent.
+func SendQueue() (lmis, expired []string, err error) { return Default.SendQueue() }
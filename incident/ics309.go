@@ -6,11 +6,11 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
-	"os"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rothskeller/gofpdf"
@@ -36,6 +36,19 @@ type ICS309Header struct {
 	TacName       string
 }
 
+// SetICS309PDF sets the PDF template (i.e., blank form) used for rendering
+// ICS-309 communications logs in PDF format, overriding the one built into the
+// program (if any).  A nil template disables PDF rendering of the log.
+func SetICS309PDF(base []byte) {
+	ics309pdfLock.Lock()
+	defer ics309pdfLock.Unlock()
+	ics309pdf = base
+}
+
+// ics309pdfLock guards ics309pdf, which SetICS309PDF may change while logs
+// are being rendered.
+var ics309pdfLock sync.RWMutex
+
 var receiptExtRE = regexp.MustCompile(`\.[DR]R\d*\.txt$`)
 
 // GenerateICS309 generates an ICS-309 communications log covering all of the
@@ -45,40 +58,40 @@ var receiptExtRE = regexp.MustCompile(`\.[DR]R\d*\.txt$`)
 // could not be read or the files could not be written.  Note that the generated
 // files are removed by any call to SaveMessage or SaveReceipt, since they could
 // be stale.
-func GenerateICS309(header *ICS309Header) (err error) {
+func (inc *Incident) GenerateICS309(header *ICS309Header) (err error) {
 	var (
-		dir   *os.File
-		files []os.FileInfo
-		msgs  []*envelope.Envelope
-		form  [][]string
-		lmis  = make(map[*envelope.Envelope]string)
+		entries []StoreEntry
+		msgs    []*envelope.Envelope
+		form    [][]string
+		lmis    = make(map[*envelope.Envelope]string)
+		unlock  func()
 	)
-	if dir, err = os.Open("."); err != nil {
+	if inc, unlock, err = inc.lock(); err != nil {
 		return err
 	}
-	defer dir.Close()
-	if files, err = dir.Readdir(0); err != nil {
+	defer unlock()
+	if entries, err = inc.store.List(); err != nil {
 		return err
 	}
-	for _, fi := range files {
+	for _, entry := range entries {
 		var (
 			lmi     string
 			rcpt    bool
 			content []byte
 			env     *envelope.Envelope
 		)
-		if !strings.HasSuffix(fi.Name(), ".txt") || !fi.Mode().IsRegular() {
+		if !strings.HasSuffix(entry.Name, ".txt") || entry.Link != "" {
 			continue
 		}
-		if idxs := receiptExtRE.FindStringIndex(fi.Name()); idxs != nil {
-			lmi, rcpt = fi.Name()[:idxs[0]], true
+		if idxs := receiptExtRE.FindStringIndex(entry.Name); idxs != nil {
+			lmi, rcpt = entry.Name[:idxs[0]], true
 		} else {
-			lmi = fi.Name()[:len(fi.Name())-4]
+			lmi = entry.Name[:len(entry.Name)-4]
 		}
 		if !MsgIDRE.MatchString(lmi) {
 			continue
 		}
-		if content, err = os.ReadFile(fi.Name()); err != nil {
+		if content, err = inc.store.ReadFile(entry.Name); err != nil {
 			continue
 		}
 		if env, _, err = envelope.ParseSaved(string(content)); err != nil {
@@ -96,18 +109,18 @@ func GenerateICS309(header *ICS309Header) (err error) {
 	sort.Slice(msgs, func(i, j int) bool { return envelopeLess(msgs[i], msgs[j]) })
 	// Generate the form data.
 	for _, m := range msgs {
-		if lines, err := make309Lines(m, lmis[m]); err != nil {
+		if lines, err := inc.make309Lines(m, lmis[m]); err != nil {
 			return err
 		} else {
 			form = append(form, lines...)
 		}
 	}
 	// Render the form.
-	RemoveICS309s()
-	if err = render309CSV(header, form); err != nil {
+	inc.RemoveICS309s()
+	if err = inc.render309CSV(header, form); err != nil {
 		return err
 	}
-	if err = render309PDF(header, form); err != nil {
+	if err = inc.render309PDF(header, form); err != nil {
 		return err
 	}
 	return nil
@@ -130,13 +143,13 @@ func envelopeLess(a, b *envelope.Envelope) bool {
 }
 
 // make309Lines generates one or more ICS-309 form lines for a single message.
-func make309Lines(m *envelope.Envelope, lmi string) (lines [][]string, err error) {
+func (inc *Incident) make309Lines(m *envelope.Envelope, lmi string) (lines [][]string, err error) {
 	if m.IsReceived() {
 		return [][]string{make309Line(m, lmi, nil)}, nil
 	} else if lmi == "" { // outgoing receipt
 		return [][]string{make309Line(m, "", &DeliveryInfo{Recipient: m.To})}, nil
 	} else {
-		if delivs, err := Deliveries(lmi); err != nil {
+		if delivs, err := inc.Deliveries(lmi); err != nil {
 			return nil, err
 		} else {
 			lines = make([][]string, len(delivs))
@@ -173,6 +186,9 @@ func make309Line(m *envelope.Envelope, lmi string, deliv *DeliveryInfo) []string
 		}
 		to, _, _ = strings.Cut(to, "@")
 		to = strings.ToUpper(to)
+		if deliv.Header == "Cc" || deliv.Header == "Bcc" {
+			to += " (" + deliv.Header + ")"
+		}
 	}
 	sub = m.SubjectLine
 	if strings.HasPrefix(m.SubjectLine, "DELIVERED: ") {
@@ -194,18 +210,11 @@ func make309Line(m *envelope.Envelope, lmi string, deliv *DeliveryInfo) []string
 }
 
 // render309CSV renders the ICS-309 in CSV format.
-func render309CSV(header *ICS309Header, form [][]string) (err error) {
-	const filename = "ics309.csv"
+func (inc *Incident) render309CSV(header *ICS309Header, form [][]string) (err error) {
 	var (
-		fh *os.File
-		w  *csv.Writer
+		buf bytes.Buffer
+		w   = csv.NewWriter(&buf)
 	)
-	if fh, err = os.Create(filename); err != nil {
-		return err
-	}
-	defer fh.Close()
-	w = csv.NewWriter(fh)
-	defer w.Flush()
 	w.Write([]string{"ICS 309 COMMUNICATIONS LOG"})
 	w.Write([]string{"Incident Name:", header.IncidentName})
 	w.Write([]string{"Activation Number:", header.ActivationNum})
@@ -218,14 +227,17 @@ func render309CSV(header *ICS309Header, form [][]string) (err error) {
 	w.Write([]string{"Prepared:", time.Now().Format("01/02/2006 15:04")})
 	w.Write([]string{})
 	w.Write([]string{"Date/Time", "From Station", "Origin Msg ID", "To Station", "Dest Msg ID", "Subject"})
-	w.WriteAll(form)
-	return nil
+	if err = w.WriteAll(form); err != nil {
+		return err
+	}
+	return inc.store.WriteFile("ics309.csv", buf.Bytes())
 }
 
 // render309PDF renders the ICS-309 in PDF format.
-func render309PDF(header *ICS309Header, form [][]string) (err error) {
-	const filename = "ics309.pdf"
+func (inc *Incident) render309PDF(header *ICS309Header, form [][]string) (err error) {
 	var (
+		buf   bytes.Buffer
+		base  []byte
 		rdr   io.ReadSeeker
 		pdf   *gofpdf.Fpdf
 		imp   *gofpdi.Importer
@@ -233,11 +245,14 @@ func render309PDF(header *ICS309Header, form [][]string) (err error) {
 		pages = (len(form) + 30) / 31
 		page  = 1
 	)
-	if ics309pdf == nil { // built without PDF support
+	ics309pdfLock.RLock()
+	base = ics309pdf
+	ics309pdfLock.RUnlock()
+	if base == nil { // no template available
 		return nil
 	}
 	// Create the output PDF and the importer from the base PDF.
-	rdr = bytes.NewReader(ics309pdf)
+	rdr = bytes.NewReader(base)
 	pdf = gofpdf.New("P", "pt", "Letter", "")
 	pdf.SetAutoPageBreak(false, 0)
 	pdf.SetMargins(0, 0, 0)
@@ -258,11 +273,10 @@ func render309PDF(header *ICS309Header, form [][]string) (err error) {
 	pdf.AddPage()
 	imp.UseImportedTemplate(pdf, imp.ImportPageFromStream(pdf, &rdr, 2, "/MediaBox"), 0, 0, 612, 792)
 	// Write the file.
-	if err = pdf.OutputFileAndClose(filename); err != nil {
-		os.Remove(filename)
+	if err = pdf.Output(&buf); err != nil {
 		return err
 	}
-	return nil
+	return inc.store.WriteFile("ics309.pdf", buf.Bytes())
 }
 
 func render309PDFHeaderFooter(pdf *gofpdf.Fpdf, header *ICS309Header, page, pages int) {
@@ -303,7 +317,11 @@ func render309PDFString(pdf *gofpdf.Fpdf, s string, x, y, w, h float64) {
 }
 
 // RemoveICS309s removes generated ICS-309 communication log files.
-func RemoveICS309s() {
-	os.Remove("ics309.csv")
-	os.Remove("ics309.pdf")
+func (inc *Incident) RemoveICS309s() {
+	if linc, unlock, err := inc.lock(); err == nil { // else proceed unlocked
+		inc = linc
+		defer unlock()
+	}
+	inc.store.Remove("ics309.csv")
+	inc.store.Remove("ics309.pdf")
 }
@@ -0,0 +1,34 @@
+package incident
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestSetICS309PDFConcurrent changes the ICS-309 template while logs are
+// being generated.  It is meaningful only under the race detector.
+func TestSetICS309PDFConcurrent(t *testing.T) {
+	var (
+		inc  = New(NewMemoryStore())
+		orig = ics309pdf
+		wg   sync.WaitGroup
+	)
+	defer SetICS309PDF(orig)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			SetICS309PDF(nil)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			if err := inc.GenerateICS309(&ICS309Header{IncidentName: "Test"}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -1,15 +1,20 @@
 // Package incident manages collections of related messages.
 //
-// An incident is stored on disk as a directory of message files; each separate
-// incident is a separate directory.  Specifically, package incident always
-// works with the message files in the current working directory of the calling
-// program.
+// An incident is normally stored on disk as a directory of message files; each
+// separate incident is a separate directory.  An Incident value, returned by
+// Open, works with the message files in a specific directory.  The
+// package-level functions work with the message files in the current working
+// directory of the calling program.  Other storage can be used by passing a
+// Store to New; in particular, a MemoryStore keeps the files in memory, for
+// tests and embedded tools that should not touch the disk.
 //
-// Within the directory, each non-receipt message is stored in a file called
-// «LMI».txt, where «LMI» is the local message ID for the message.  If any
-// remote message IDs for the message are known, symbolic links name «RMI».txt
-// point to «LMI».txt.  (There may be multiple remote message IDs if the message
-// was sent to multiple recipients.)
+// Within the directory (or other Store), each non-receipt message is stored in
+// a file called «LMI».txt, where «LMI» is the local message ID for the message.
+// If any remote message IDs for the message are known, symbolic links name
+// «RMI».txt point to «LMI».txt.  (There may be multiple remote message IDs if
+// the message was sent to multiple recipients.)  On file systems that don't
+// support symbolic links, the incident can instead use an index file,
+// rmi-index.txt, to map RMIs to LMIs; see Layout.
 //
 // Messages are automatically rendered in PDF format if the message type
 // supports it and PDF rendering is built into the program; the PDF version is
@@ -20,6 +25,14 @@
 // (Multiple receipts may be received for a message if it was sent to multiple
 // recipients.)  There are no «RMI» symbolic links for those.
 //
+// Attachments of received messages (e.g., photos attached to messages from
+// email gateways) are stored in «LMI».A.«filename».
+//
+// Changes to an incident are protected by a lock in the Store (for FSStore, an
+// advisory lock on the file .lock), so that multiple goroutines and processes
+// can safely work on the same incident.  Sequences of operations that must be
+// atomic can be performed with WithLock.
+//
 // On request, package incident can also generate an ICS-309 message log for the
 // messages in the directory.  This is stored in CSV format in ics309.csv, and
 // if PDF rendering is built into the program, it is rendered in PDF format in
@@ -30,7 +43,9 @@ package incident
 import (
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strconv"
@@ -48,35 +63,75 @@ import (
 // the optional suffix character.
 var MsgIDRE = regexp.MustCompile(`^([0-9][A-Z]{2}|[A-Z][A-Z0-9]{2})-([1-9][0-9]{2,}|0[1-9][0-9]|00[1-9])([A-Z]?)$`)
 
+// An Incident is a handle on the stored messages of an incident.  Its methods
+// perform all of the operations of this package on those messages.  It is
+// safe to have Incident values for multiple incidents open at once.
+type Incident struct {
+	store  Store
+	alloc  *Allocator
+	locked bool
+}
+
+// Open returns an Incident for the incident stored in the specified directory.
+// It returns an error if the directory does not exist.
+func Open(dir string) (inc *Incident, err error) {
+	var info os.FileInfo
+
+	if info, err = os.Stat(dir); err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s: not a directory", dir)
+	}
+	return New(NewFSStore(dir)), nil
+}
+
+// New returns an Incident for the incident stored in the specified Store.
+func New(store Store) *Incident {
+	return &Incident{store: store}
+}
+
+// Store returns the storage backend of the incident.
+func (inc *Incident) Store() Store { return inc.store }
+
 // MessageExists returns true if a message exists with the specified LMI.
-func MessageExists(lmi string) bool {
+func (inc *Incident) MessageExists(lmi string) bool {
 	if !MsgIDRE.MatchString(lmi) {
 		return false
 	}
-	if info, err := os.Stat(lmi + ".txt"); err == nil && info.Mode().IsRegular() {
-		return true
+	entry, err := inc.store.Stat(lmi + ".txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		if target := inc.LMIForRMI(lmi); target != "" {
+			entry, err = StoreEntry{Link: target + ".txt"}, nil
+		}
 	}
-	return false
+	if err == nil && entry.Link != "" {
+		entry, err = inc.store.Stat(entry.Link)
+	}
+	return err == nil && entry.Link == ""
 }
 
 // LMIForRMI returns the LMI for the message with the given RMI, if any.  It
 // returns "" if the RMI doesn't exist.
-func LMIForRMI(rmi string) string {
+func (inc *Incident) LMIForRMI(rmi string) string {
 	var (
-		info os.FileInfo
-		lmi  string
-		err  error
+		entry StoreEntry
+		index map[string]string
+		lmi   string
+		err   error
 	)
 	if !MsgIDRE.MatchString(rmi) {
 		return ""
 	}
-	if info, err = os.Stat(rmi + ".txt"); err != nil || info.Mode().Type() != os.ModeSymlink {
+	if index, err = inc.readRMIIndex(); err != nil {
 		return ""
+	} else if index != nil {
+		return index[rmi]
 	}
-	if lmi, err = os.Readlink(rmi + ".txt"); err != nil || !strings.HasSuffix(lmi, ".txt") {
+	if entry, err = inc.store.Stat(rmi + ".txt"); err != nil || !strings.HasSuffix(entry.Link, ".txt") {
 		return ""
 	}
-	lmi = lmi[:len(lmi)-4]
+	lmi = entry.Link[:len(entry.Link)-4]
 	if !MsgIDRE.MatchString(lmi) {
 		return ""
 	}
@@ -84,10 +139,10 @@ func LMIForRMI(rmi string) string {
 }
 
 // ReadMessage reads a message from the incident directory and returns it.
-func ReadMessage(lmi string) (env *envelope.Envelope, msg message.Message, err error) {
+func (inc *Incident) ReadMessage(lmi string) (env *envelope.Envelope, msg message.Message, err error) {
 	var body string
 
-	if env, body, err = readEnvelope(lmi, ""); err != nil {
+	if env, body, err = inc.readEnvelope(lmi, ""); err != nil {
 		return env, nil, err
 	}
 	msg = message.Decode(env, body)
@@ -95,17 +150,17 @@ func ReadMessage(lmi string) (env *envelope.Envelope, msg message.Message, err e
 }
 
 // ReadReceipt reads a receipt for a message.  rcpt must be "DR#" or "RR#".
-func ReadReceipt(lmi, rcpt string) (env *envelope.Envelope, msg message.Message, err error) {
+func (inc *Incident) ReadReceipt(lmi, rcpt string) (env *envelope.Envelope, msg message.Message, err error) {
 	var body string
 
-	if env, body, err = readEnvelope(lmi, rcpt); err != nil {
+	if env, body, err = inc.readEnvelope(lmi, rcpt); err != nil {
 		return env, nil, err
 	}
 	msg = message.Decode(env, body)
 	return env, msg, nil
 }
 
-func readEnvelope(lmi, rcpt string) (env *envelope.Envelope, body string, err error) {
+func (inc *Incident) readEnvelope(lmi, rcpt string) (env *envelope.Envelope, body string, err error) {
 	var (
 		fname    string
 		contents []byte
@@ -118,7 +173,13 @@ func readEnvelope(lmi, rcpt string) (env *envelope.Envelope, body string, err er
 		fname += "." + rcpt
 	}
 	fname += ".txt"
-	if contents, err = os.ReadFile(fname); err != nil {
+	contents, err = inc.store.ReadFile(fname)
+	if errors.Is(err, fs.ErrNotExist) && rcpt == "" {
+		if target := inc.LMIForRMI(lmi); target != "" {
+			contents, err = inc.store.ReadFile(target + ".txt")
+		}
+	}
+	if err != nil {
 		return nil, "", err
 	}
 	if env, body, err = envelope.ParseSaved(string(contents)); err != nil {
@@ -129,11 +190,15 @@ func readEnvelope(lmi, rcpt string) (env *envelope.Envelope, body string, err er
 
 // SaveMessage saves a (non-receipt) message to the incident directory,
 // overwriting any previous message stored with the same LMI.  If rmi is not
-// empty, an RMI symlink is created.  (Existing RMI symlinks are not disturbed.)
+// empty, it is recorded as an RMI for the message, as a symlink or an RMI index
+// entry depending on the incident's RMILayout.  (Existing RMI records are not
+// disturbed.)
 // If fast is true, PDFs are not generated even when possible; stale PDFs are
 // removed.  If rawsubj is true, the envelope Subject: line is left unchanged
 // rather than being regenerated based on the message contents.
-func SaveMessage(lmi, rmi string, env *envelope.Envelope, msg message.Message, fast, rawsubj bool) (err error) {
+func (inc *Incident) SaveMessage(lmi, rmi string, env *envelope.Envelope, msg message.Message, fast, rawsubj bool) (err error) {
+	var unlock func()
+
 	if !MsgIDRE.MatchString(lmi) {
 		return errors.New("invalid LMI")
 	}
@@ -144,20 +209,111 @@ func SaveMessage(lmi, rmi string, env *envelope.Envelope, msg message.Message, f
 	case *delivrcpt.DeliveryReceipt, *readrcpt.ReadReceipt:
 		panic("cannot call SaveMessage for receipt message; call SaveReceipt instead")
 	}
+	if inc, unlock, err = inc.lock(); err != nil {
+		return err
+	}
+	defer unlock()
+	if len(env.Attachments) != 0 {
+		if err = inc.saveAttachments(lmi, env.Attachments); err != nil {
+			return err
+		}
+	}
 	if rmi != "" {
-		return saveMessage(lmi+".txt", rmi+".txt", env, msg, fast, rawsubj)
+		return inc.saveMessage(lmi+".txt", rmi+".txt", env, msg, fast, rawsubj)
+	}
+	return inc.saveMessage(lmi+".txt", "", env, msg, fast, rawsubj)
+}
+
+// saveAttachments saves the attachments of a received message, each in a file
+// named «lmi».A.«filename».  Existing attachments of the message are removed
+// first.
+func (inc *Incident) saveAttachments(lmi string, attachments []envelope.Attachment) (err error) {
+	inc.removeAttachments(lmi)
+	for _, att := range attachments {
+		var filename = attachmentFilename(lmi, att.Filename)
+		for seq := 2; ; seq++ {
+			if _, err := inc.store.Stat(filename); errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			filename = attachmentFilename(lmi, fmt.Sprintf("%d.%s", seq, att.Filename))
+		}
+		if err = inc.store.WriteFile(filename, att.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachmentFilename returns the name of the file in which to save an
+// attachment with the specified name.  Any directory components and unsafe
+// characters are removed from the attachment name.
+func attachmentFilename(lmi, name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || r == '/' || r == ':' {
+			return '_'
+		}
+		return r
+	}, strings.TrimLeft(name, "."))
+	if name == "" {
+		name = "attachment"
+	}
+	return lmi + ".A." + name
+}
+
+// Attachments returns the names of the files in which the attachments of the
+// message with the specified LMI are saved.  (Their contents can be read with
+// ReadAttachment.)  It returns an empty list if the message has no
+// attachments.
+func (inc *Incident) Attachments(lmi string) (filenames []string, err error) {
+	var entries []StoreEntry
+
+	if !MsgIDRE.MatchString(lmi) {
+		return nil, errors.New("invalid LMI")
+	}
+	if entries, err = inc.store.List(); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Link == "" && strings.HasPrefix(entry.Name, lmi+".A.") {
+			filenames = append(filenames, entry.Name)
+		}
+	}
+	return filenames, nil
+}
+
+// ReadAttachment returns the contents of an attachment file, whose name was
+// returned by Attachments.
+func (inc *Incident) ReadAttachment(filename string) (data []byte, err error) {
+	if lmi, _, ok := strings.Cut(filename, ".A."); !ok || !MsgIDRE.MatchString(lmi) {
+		return nil, errors.New("invalid attachment filename")
+	}
+	return inc.store.ReadFile(filename)
+}
+
+// removeAttachments removes the saved attachments of the message with the
+// specified LMI.
+func (inc *Incident) removeAttachments(lmi string) {
+	if files, err := inc.Attachments(lmi); err == nil {
+		for _, file := range files {
+			inc.store.Remove(file)
+		}
 	}
-	return saveMessage(lmi+".txt", "", env, msg, fast, rawsubj)
 }
 
 // SaveReceipt saves a receipt message to the incident directory, with a unique
 // sequence number to avoid overwriting other receipts for the same message.
-func SaveReceipt(lmi string, env *envelope.Envelope, msg message.Message) (err error) {
+func (inc *Incident) SaveReceipt(lmi string, env *envelope.Envelope, msg message.Message) (err error) {
 	var (
 		base     string
 		filename string
 		seq      = 1
+		unlock   func()
 	)
+	if inc, unlock, err = inc.lock(); err != nil {
+		return err
+	}
+	defer unlock()
 	if !MsgIDRE.MatchString(lmi) {
 		return errors.New("invalid LMI")
 	}
@@ -171,22 +327,20 @@ func SaveReceipt(lmi string, env *envelope.Envelope, msg message.Message) (err e
 	}
 	filename = base + ".txt"
 	for {
-		if _, err := os.Stat(filename); os.IsNotExist(err) {
+		if _, err := inc.store.Stat(filename); errors.Is(err, fs.ErrNotExist) {
 			break
 		} else {
 			seq++
 			filename = fmt.Sprintf("%s%d.txt", base, seq)
 		}
 	}
-	return saveMessage(filename, "", env, msg, true, true)
+	return inc.saveMessage(filename, "", env, msg, true, true)
 }
 
 // saveMessage is the common code between SaveMessage and SaveReceipt.
-func saveMessage(filename, linkname string, env *envelope.Envelope, msg message.Message, fast, rawsubj bool) (err error) {
-	var (
-		content string
-		modtime time.Time
-	)
+func (inc *Incident) saveMessage(filename, linkname string, env *envelope.Envelope, msg message.Message, fast, rawsubj bool) (err error) {
+	var content string
+
 	// Encode the message.
 	if !rawsubj {
 		env.SubjectLine = msg.EncodeSubject()
@@ -198,62 +352,96 @@ func saveMessage(filename, linkname string, env *envelope.Envelope, msg message.
 	}
 	content = env.RenderSaved(msg.EncodeBody())
 	// Save the message to its text file.
-	if err = os.WriteFile(filename, []byte(content), 0666); err != nil {
+	if err = inc.store.WriteFile(filename, []byte(content)); err != nil {
 		return err
 	}
-	// Set the modification time of the text file based on the envelope.
-	// (This allows AllLMIs to sort by file modification time.)
-	if env.IsReceived() {
-		modtime = env.ReceivedDate
-	} else {
-		modtime = env.Date
-	}
-	if !modtime.IsZero() {
-		os.Chtimes(filename, modtime, modtime) // error ignored
-	}
-	// Create the RMI symlink for the text file if needed.
-	if linkname != "" {
-		os.Symlink(filename, linkname) // error ignored
-	}
-	// Remove any generated ICS-309 since it's now potentially out of date.
-	RemoveICS309s()
+	// Record the RMI for the text file if needed.  In the index layout,
+	// there is no RMI alias for the PDF, so we clear linkname after
+	// indexing it.
+	if linkname != "" && inc.RMILayout() == IndexLayout {
+		inc.indexRMI(linkname[:len(linkname)-4], filename[:len(filename)-4]) // error ignored
+		linkname = ""
+	} else if linkname != "" {
+		inc.store.Link(filename, linkname) // error ignored
+	}
+	// Update the search index, and remove any generated ICS-309 since it's
+	// now potentially out of date.
+	inc.updateSearchIndex(filename, env, msg)
+	inc.RemoveICS309s()
 	// If the message can be rendered as PDF, do that.
 	filename = filename[:len(filename)-4] + ".pdf"
 	if fast {
-		os.Remove(filename)
+		inc.store.Remove(filename)
 		if linkname != "" {
-			os.Remove(linkname[:len(linkname)-4] + ".pdf")
+			inc.store.Remove(linkname[:len(linkname)-4] + ".pdf")
 		}
 		// This code could leave symlinks to nonexistent PDFs if there
 		// are RMI links other than linkname.  TODO
 	} else {
 		// Render the PDF.  Ignore errors (can't allow them to prevent
-		// us from saving a received message).
-		if err = msg.RenderPDF(env, filename); err == nil && linkname != "" {
+		// us from saving a received message), but don't leave a stale
+		// PDF behind.
+		if err = inc.renderPDF(env, msg, filename); err != nil {
+			inc.store.Remove(filename)
+		} else if linkname != "" {
 			linkname = linkname[:len(linkname)-4] + ".pdf"
-			os.Symlink(filename, linkname)
+			inc.store.Link(filename, linkname)
 		}
 	}
 	return nil
 }
 
+// renderPDF renders the message in PDF format and stores it in the named file.
+// Messages can only render PDFs into real files, so for stores other than
+// FSStore, the PDF is rendered into a temporary file and copied into the store.
+func (inc *Incident) renderPDF(env *envelope.Envelope, msg message.Message, filename string) (err error) {
+	var (
+		tmp  *os.File
+		data []byte
+	)
+	if fss, ok := inc.store.(*FSStore); ok {
+		return msg.RenderPDF(env, fss.Path(filename))
+	}
+	if tmp, err = os.CreateTemp("", "*.pdf"); err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err = msg.RenderPDF(env, tmp.Name()); err != nil {
+		return err
+	}
+	if data, err = os.ReadFile(tmp.Name()); err != nil {
+		return err
+	}
+	return inc.store.WriteFile(filename, data)
+}
+
 // RemoveMessage removes the message with the specified LMI.
-func RemoveMessage(lmi string) {
+func (inc *Incident) RemoveMessage(lmi string) {
+	if linc, unlock, err := inc.lock(); err == nil { // else proceed unlocked
+		inc = linc
+		defer unlock()
+	}
 	if !MsgIDRE.MatchString(lmi) {
 		panic("invalid LMI")
 	}
-	os.Remove(lmi + ".txt")
-	os.Remove(lmi + ".pdf")
-	// This code could leave RMI symlinks to the message.  But client code
-	// doesn't call this except for unsent messages, so it shouldn't be an
-	// issue.
+	inc.store.Remove(lmi + ".txt")
+	inc.store.Remove(lmi + ".pdf")
+	inc.removeAttachments(lmi)
+	inc.updateSearchIndex(lmi+".txt", nil, nil)
+	inc.unindexLMI(lmi)
+	// In SymlinkLayout, this code could leave RMI symlinks to the message.
+	// But client code doesn't call this except for unsent messages, so it
+	// shouldn't be an issue.
 }
 
 // UniqueMessageID returns the provided message ID if there is no existing
 // message in the directory with that ID (local or remote).  Otherwise, it
 // increments the sequence number until the message ID is unused, and returns
-// the result.
-func UniqueMessageID(id string) string {
+// the result.  If other goroutines or processes may be saving messages at the
+// same time, call UniqueMessageID and SaveMessage together inside WithLock, so
+// that the returned ID can't be taken before it is used.
+func (inc *Incident) UniqueMessageID(id string) string {
 	var (
 		prefix string
 		seq    int
@@ -266,7 +454,7 @@ func UniqueMessageID(id string) string {
 		panic("UniqueMessageID called for invalid ID")
 	}
 	for {
-		if _, err := os.Stat(id + ".txt"); errors.Is(err, os.ErrNotExist) {
+		if _, err := inc.store.Stat(id + ".txt"); errors.Is(err, fs.ErrNotExist) && inc.LMIForRMI(id) == "" {
 			return id
 		}
 		seq++
@@ -274,38 +462,45 @@ func UniqueMessageID(id string) string {
 	}
 }
 
-// AllLMIs returns a list of local message IDs of all messages in the directory.
-// The list is in chronological order.  An error is returned only if the
-// directory cannot be read.
-func AllLMIs() (lmis []string, err error) {
+// AllLMIs returns a list of local message IDs of all messages in the incident.
+// The list is in chronological order, based on the date each message was
+// received (for received messages) or sent (for outgoing messages).  Unsent
+// messages come last, in LMI order.  An error is returned only if the store
+// cannot be read.
+func (inc *Incident) AllLMIs() (lmis []string, err error) {
 	var (
-		dir   *os.File
-		files []os.FileInfo
+		entries []StoreEntry
+		times   = make(map[string]time.Time)
 	)
-	if dir, err = os.Open("."); err != nil {
+	if entries, err = inc.store.List(); err != nil {
 		return nil, err
 	}
-	defer dir.Close()
-	if files, err = dir.Readdir(0); err != nil {
-		return nil, err
-	}
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].ModTime().Before(files[j].ModTime())
-	})
-	for _, fi := range files {
+	for _, entry := range entries {
 		var lmi string
 
-		if !fi.Mode().IsRegular() {
+		if entry.Link != "" || !strings.HasSuffix(entry.Name, ".txt") {
 			continue
 		}
-		if !strings.HasSuffix(fi.Name(), ".txt") {
+		lmi = entry.Name[:len(entry.Name)-4]
+		if !MsgIDRE.MatchString(lmi) {
 			continue
 		}
-		lmi = fi.Name()[:len(fi.Name())-4]
-		if MsgIDRE.MatchString(lmi) {
-			lmis = append(lmis, lmi)
+		lmis = append(lmis, lmi)
+		if env, _, err := inc.readEnvelope(lmi, ""); err == nil {
+			if env.IsReceived() {
+				times[lmi] = env.ReceivedDate
+			} else {
+				times[lmi] = env.Date
+			}
 		}
 	}
+	sort.SliceStable(lmis, func(i, j int) bool {
+		ti, tj := times[lmis[i]], times[lmis[j]]
+		if ti.IsZero() || tj.IsZero() {
+			return !ti.IsZero() && tj.IsZero()
+		}
+		return ti.Before(tj)
+	})
 	return lmis, nil
 }
 
@@ -314,48 +509,43 @@ func AllLMIs() (lmis []string, err error) {
 // whose RMI has the requested sequence number are also included.  The LMIs are
 // returned in unspecified order.  An error is returned only if the directory
 // cannot be read.
-func SeqToLMI(seq int, remote bool) (lmis []string, err error) {
+func (inc *Incident) SeqToLMI(seq int, remote bool) (lmis []string, err error) {
 	var (
-		dir    *os.File
-		files  []os.FileInfo
-		seqstr = fmt.Sprintf("%03d", seq)
+		entries []StoreEntry
+		index   map[string]string
+		seqstr  = fmt.Sprintf("%03d", seq)
 	)
 	if seq <= 0 {
 		panic("SeqToLMI sequence number must be positive")
 	}
-	if dir, err = os.Open("."); err != nil {
+	if entries, err = inc.store.List(); err != nil {
 		return nil, err
 	}
-	defer dir.Close()
-	if files, err = dir.Readdir(0); err != nil {
+	if index, err = inc.readRMIIndex(); err != nil {
 		return nil, err
 	}
-	for _, fi := range files {
+	if remote {
+		for rmi, lmi := range index {
+			if match := MsgIDRE.FindStringSubmatch(rmi); match != nil && match[2] == seqstr {
+				entries = append(entries, StoreEntry{Name: rmi + ".txt", Link: lmi + ".txt"})
+			}
+		}
+	}
+	for _, entry := range entries {
 		var mid string
 
-		if !strings.HasSuffix(fi.Name(), ".txt") {
+		if !strings.HasSuffix(entry.Name, ".txt") {
 			continue
 		}
-		mid = fi.Name()[:len(fi.Name())-4]
+		mid = entry.Name[:len(entry.Name)-4]
 		if match := MsgIDRE.FindStringSubmatch(mid); match == nil || match[2] != seqstr {
 			continue
 		}
-		switch fi.Mode().Type() {
-		case 0: // regular file
+		switch {
+		case entry.Link == "":
 			lmis = append(lmis, mid)
-		case os.ModeSymlink:
-			var target string
-
-			if !remote {
-				break
-			}
-			if target, err = os.Readlink(fi.Name()); err != nil {
-				break
-			}
-			if !strings.HasSuffix(target, ".txt") {
-				break
-			}
-			mid = target[:len(target)-4]
+		case remote && strings.HasSuffix(entry.Link, ".txt"):
+			mid = entry.Link[:len(entry.Link)-4]
 			if MsgIDRE.MatchString(mid) {
 				lmis = append(lmis, mid)
 			}
@@ -369,6 +559,10 @@ type DeliveryInfo struct {
 	// Recipient is the address of the recipient to which the message was
 	// addressed.  Display names are removed and domains are fleshed out.
 	Recipient string
+	// Header is the header in which the recipient was listed:  "To",
+	// "Cc", or "Bcc".  It is empty for a recipient that was not listed in
+	// the message but sent a delivery receipt for it anyway.
+	Header string
 	// DeliveredTime is the date and time when the message was delivered to
 	// the recipient, as described in the delivery receipt they sent back.
 	// (It is a string because there is no standard time formatting for this
@@ -387,37 +581,42 @@ type DeliveryInfo struct {
 
 // Deliveries returns the delivery information for an outgoing message.  One
 // DeliveryInfo structure is returned for each distinct To/Cc/Bcc address in the
-// message.  (If there are none, a single structure is returned.)  An error is
-// returned only if files cannot be read or decoded.
-func Deliveries(lmi string) (delivs []*DeliveryInfo, err error) {
+// message.  (If there are none, a single structure is returned.)  The message
+// may be identified by its LMI or by one of its RMIs.  An error is returned
+// only if files cannot be read or decoded.
+func (inc *Incident) Deliveries(lmi string) (delivs []*DeliveryInfo, err error) {
 	var (
-		env   *envelope.Envelope
-		addrs []*envelope.Address
-		seq   = 2
+		env *envelope.Envelope
+		seq = 2
 	)
-	if env, _, err = readEnvelope(lmi, ""); err != nil {
+	if target := inc.LMIForRMI(lmi); target != "" {
+		lmi = target // receipts are stored under the LMI
+	}
+	if env, _, err = inc.readEnvelope(lmi, ""); err != nil {
 		return nil, err
 	}
 	if env.IsReceived() {
 		return nil, fmt.Errorf("%s: not an outgoing message", lmi)
 	}
-	if addrs, err = envelope.ParseAddressList(env.To); err != nil {
-		return nil, fmt.Errorf("%s: invalid To field: %s", lmi, err)
+	for _, list := range []struct{ header, addrs string }{{"To", env.To}, {"Cc", env.Cc}, {"Bcc", env.Bcc}} {
+		addrs, err := envelope.ParseAddressList(list.addrs)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid %s field: %s", lmi, list.header, err)
+		}
+		for _, addr := range addrs {
+			delivs = append(delivs, &DeliveryInfo{Recipient: addr.Address, Header: list.header})
+		}
 	}
-	if len(addrs) == 0 {
+	if len(delivs) == 0 {
 		return []*DeliveryInfo{{}}, nil
 	}
-	delivs = make([]*DeliveryInfo, len(addrs))
-	for i, addr := range addrs {
-		delivs[i] = &DeliveryInfo{Recipient: addr.Address}
-	}
-	if deliv, err := readDelivery(lmi + ".DR.txt"); err != nil && !os.IsNotExist(err) {
+	if deliv, err := inc.readDelivery(lmi + ".DR.txt"); err != nil && !os.IsNotExist(err) {
 		return nil, err
 	} else if deliv != nil {
 		delivs = assignDelivery(delivs, deliv)
 	}
 	for {
-		if deliv, err := readDelivery(fmt.Sprintf("%s.DR%d.txt", lmi, seq)); err != nil && !os.IsNotExist(err) {
+		if deliv, err := inc.readDelivery(fmt.Sprintf("%s.DR%d.txt", lmi, seq)); err != nil && !os.IsNotExist(err) {
 			return nil, err
 		} else if deliv != nil {
 			delivs = assignDelivery(delivs, deliv)
@@ -430,7 +629,7 @@ func Deliveries(lmi string) (delivs []*DeliveryInfo, err error) {
 }
 
 // readDelivery reads a delivery receipt and creates a DeliveryInfo.
-func readDelivery(fname string) (deliv *DeliveryInfo, err error) {
+func (inc *Incident) readDelivery(fname string) (deliv *DeliveryInfo, err error) {
 	var (
 		contents []byte
 		env      *envelope.Envelope
@@ -438,7 +637,7 @@ func readDelivery(fname string) (deliv *DeliveryInfo, err error) {
 		msg      message.Message
 		dr       *delivrcpt.DeliveryReceipt
 	)
-	if contents, err = os.ReadFile(fname); err != nil {
+	if contents, err = inc.store.ReadFile(fname); err != nil {
 		return nil, err
 	}
 	if env, body, err = envelope.ParseSaved(string(contents)); err != nil {
@@ -451,7 +650,7 @@ func readDelivery(fname string) (deliv *DeliveryInfo, err error) {
 	if dr, _ = msg.(*delivrcpt.DeliveryReceipt); dr == nil || !env.IsReceived() {
 		return nil, fmt.Errorf("%s: not a received delivery receipt", fname)
 	}
-	return &DeliveryInfo{env.From, dr.DeliveredTime, dr.LocalMessageID, env.ReceivedBBS}, nil
+	return &DeliveryInfo{env.From, "", dr.DeliveredTime, dr.LocalMessageID, env.ReceivedBBS}, nil
 }
 
 // assignDelivery assigns a DeliveryInfo to the correct recipient in the
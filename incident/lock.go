@@ -0,0 +1,38 @@
+package incident
+
+// This file contains the locking that makes changes to an incident safe when
+// multiple goroutines or processes are working on it at once.
+
+// lock acquires the incident's store lock.  It returns an Incident to be used
+// while the lock is held, and a function to release the lock.  If inc already
+// holds the lock (i.e., it was returned by an earlier call to lock), lock does
+// nothing, so that locked methods can call each other.
+func (inc *Incident) lock() (linc *Incident, unlock func(), err error) {
+	if inc.locked {
+		return inc, func() {}, nil
+	}
+	if unlock, err = inc.store.Lock(); err != nil {
+		return nil, nil, err
+	}
+	return &Incident{store: inc.store, alloc: inc.alloc, locked: true}, unlock, nil
+}
+
+// WithLock calls fn with the incident locked against changes by other
+// goroutines and processes.  This is for callers that need a sequence of
+// operations to be atomic, such as allocating a message ID with
+// UniqueMessageID and then saving a message with it.  fn must do its work
+// through the Incident passed to it, not through inc; otherwise it will
+// deadlock.  WithLock returns the error returned by fn, or an error if the
+// lock cannot be acquired.
+//
+// Individual methods that change the incident lock it themselves, so there's
+// no need to use WithLock for them.
+func (inc *Incident) WithLock(fn func(inc *Incident) error) (err error) {
+	var unlock func()
+
+	if inc, unlock, err = inc.lock(); err != nil {
+		return err
+	}
+	defer unlock()
+	return fn(inc)
+}
@@ -0,0 +1,32 @@
+//go:build !unix
+
+package incident
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+var (
+	lockFilesMutex sync.Mutex
+	lockFiles      = make(map[string]*sync.Mutex)
+)
+
+// lockFile acquires an exclusive lock on the named file and returns a function
+// that releases the lock.  It waits until the lock is available.  On this
+// platform, there is no advisory file locking, so the lock only excludes other
+// goroutines of this process.
+func lockFile(name string) (unlock func(), err error) {
+	if abs, err := filepath.Abs(name); err == nil {
+		name = abs
+	}
+	lockFilesMutex.Lock()
+	mutex := lockFiles[name]
+	if mutex == nil {
+		mutex = new(sync.Mutex)
+		lockFiles[name] = mutex
+	}
+	lockFilesMutex.Unlock()
+	mutex.Lock()
+	return mutex.Unlock, nil
+}
@@ -0,0 +1,143 @@
+package incident
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/xscmsg/delivrcpt"
+	"github.com/rothskeller/packet/xscmsg/plaintext"
+)
+
+// saveNewMessage saves a new outgoing message with an LMI allocated from
+// msgid, and returns the LMI.
+func saveNewMessage(inc *Incident, msgid string) (lmi string, err error) {
+	err = inc.WithLock(func(inc *Incident) error {
+		var (
+			env = &envelope.Envelope{From: "a@b", To: "c@d", Date: time.Now()}
+			msg = plaintext.New()
+		)
+		lmi = inc.UniqueMessageID(msgid)
+		env.SubjectLine = lmi + "_R_test"
+		return inc.SaveMessage(lmi, "", env, msg, true, true)
+	})
+	return lmi, err
+}
+
+// saveDeliveryReceipt saves a delivery receipt for the specified message.
+func saveDeliveryReceipt(inc *Incident, lmi string) error {
+	var (
+		env = &envelope.Envelope{From: "c@d", To: "a@b", Date: time.Now()}
+		dr  = delivrcpt.New()
+	)
+	dr.LocalMessageID = "AAA-001P"
+	env.SubjectLine = dr.EncodeSubject()
+	return inc.SaveReceipt(lmi, env, dr)
+}
+
+func testConcurrentGoroutines(t *testing.T, inc *Incident) {
+	const workers, count = 8, 10
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		lmis = make(map[string]bool)
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < count; i++ {
+				lmi, err := saveNewMessage(inc, "XND-001P")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if lmis[lmi] {
+					t.Errorf("LMI %s allocated twice", lmi)
+				}
+				lmis[lmi] = true
+				mu.Unlock()
+				if err = saveDeliveryReceipt(inc, "XND-001P"); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if all, err := inc.AllLMIs(); err != nil {
+		t.Fatal(err)
+	} else if len(all) != workers*count {
+		t.Errorf("got %d messages, expected %d", len(all), workers*count)
+	}
+	entries, err := inc.store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var receipts int
+	for _, entry := range entries {
+		if receiptExtRE.MatchString(entry.Name) {
+			receipts++
+		}
+	}
+	if receipts != workers*count {
+		t.Errorf("got %d receipts, expected %d", receipts, workers*count)
+	}
+}
+
+func TestConcurrentGoroutinesMemory(t *testing.T) {
+	testConcurrentGoroutines(t, New(NewMemoryStore()))
+}
+
+func TestConcurrentGoroutinesFS(t *testing.T) {
+	inc, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testConcurrentGoroutines(t, inc)
+}
+
+func TestAtomicWrite(t *testing.T) {
+	var (
+		wg   sync.WaitGroup
+		done = make(chan struct{})
+	)
+	inc, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = saveNewMessage(inc, "XND-001P"); err != nil {
+		t.Fatal(err)
+	}
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if _, _, err := inc.ReadMessage("XND-001P"); err != nil {
+					t.Errorf("read during rewrite: %s", err)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		env := &envelope.Envelope{From: "a@b", To: "c@d", Date: time.Now()}
+		msg := plaintext.New().(*plaintext.PlainText)
+		msg.Subject = fmt.Sprintf("Rewrite %d", i)
+		if err = inc.SaveMessage("XND-001P", "", env, msg, true, false); err != nil {
+			t.Error(err)
+			break
+		}
+	}
+	close(done)
+	wg.Wait()
+}
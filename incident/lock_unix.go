@@ -0,0 +1,33 @@
+//go:build unix
+
+package incident
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile acquires an exclusive advisory lock on the named file, creating it
+// if needed, and returns a function that releases the lock.  It waits until
+// the lock is available.  The lock excludes other processes as well as other
+// goroutines of this one.
+func lockFile(name string) (unlock func(), err error) {
+	var fh *os.File
+
+	if fh, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0666); err != nil {
+		return nil, err
+	}
+	for {
+		if err = syscall.Flock(int(fh.Fd()), syscall.LOCK_EX); err != syscall.EINTR {
+			break
+		}
+	}
+	if err != nil {
+		fh.Close()
+		return nil, &os.PathError{Op: "flock", Path: name, Err: err}
+	}
+	return func() {
+		syscall.Flock(int(fh.Fd()), syscall.LOCK_UN)
+		fh.Close()
+	}, nil
+}
@@ -0,0 +1,77 @@
+//go:build unix
+
+package incident
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestLockHelperProcess is not a real test.  It is run as a subprocess by
+// TestConcurrentProcesses, to save messages into a shared incident.
+func TestLockHelperProcess(t *testing.T) {
+	var dir = os.Getenv("INCIDENT_LOCK_TEST_DIR")
+	if dir == "" {
+		t.Skip("only run as a subprocess of TestConcurrentProcesses")
+	}
+	inc, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err = saveNewMessage(inc, "XND-001P"); err != nil {
+			t.Fatal(err)
+		}
+		if err = saveDeliveryReceipt(inc, "XND-001P"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestConcurrentProcesses(t *testing.T) {
+	const procs = 4
+	var (
+		dir  = t.TempDir()
+		cmds []*exec.Cmd
+		outs []*strings.Builder
+	)
+	for p := 0; p < procs; p++ {
+		var out strings.Builder
+		cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+		cmd.Env = append(os.Environ(), "INCIDENT_LOCK_TEST_DIR="+dir)
+		cmd.Stdout, cmd.Stderr = &out, &out
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		cmds, outs = append(cmds, cmd), append(outs, &out)
+	}
+	for p, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("subprocess %d: %s\n%s", p, err, outs[p])
+		}
+	}
+	inc, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if all, err := inc.AllLMIs(); err != nil {
+		t.Fatal(err)
+	} else if len(all) != procs*10 {
+		t.Errorf("got %d messages, expected %d", len(all), procs*10)
+	}
+	entries, err := inc.store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var receipts int
+	for _, entry := range entries {
+		if receiptExtRE.MatchString(entry.Name) {
+			receipts++
+		}
+	}
+	if receipts != procs*10 {
+		t.Errorf("got %d receipts, expected %d", receipts, procs*10)
+	}
+}
@@ -0,0 +1,205 @@
+package incident
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+	"github.com/rothskeller/packet/xscmsg/delivrcpt"
+	"github.com/rothskeller/packet/xscmsg/readrcpt"
+)
+
+// mboxLMIHeader is the header in which ExportMbox records the LMI of each
+// message, and of the message to which each receipt belongs.
+const mboxLMIHeader = "X-Packet-LMI"
+
+// ImportMbox imports all of the messages in the supplied mbox file into the
+// incident, and returns the LMIs of the imported messages.  Messages that were
+// exported by ExportMbox are restored as they were saved, including their
+// LMIs where those are not already in use.  Other messages (e.g., from a
+// Thunderbird archive) are treated as having been received from the specified
+// BBS, and are given new LMIs based on the message ID pattern msgid.  Received
+// receipts are matched against the messages they acknowledge, as if they had
+// just been received; receipts that we sent are attached to the message they
+// were exported with.  Messages that cannot be parsed are skipped with a
+// Warning, and the import continues.
+func (inc *Incident) ImportMbox(r io.Reader, bbs, msgid string) (lmis []string, err error) {
+	var (
+		mr       = envelope.NewMboxReader(r)
+		count    int
+		warns    []string
+		last     string
+		imported = make(map[string]string)
+		unlock   func()
+	)
+	if inc, unlock, err = inc.lock(); err != nil {
+		return nil, err
+	}
+	defer unlock()
+	for {
+		var (
+			raw     string
+			lmi     string
+			elmi    string
+			env     *envelope.Envelope
+			body    string
+			msg     message.Message
+			receipt bool
+		)
+		if raw, err = mr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			return lmis, err
+		}
+		count++
+		if env, body, elmi, err = parseImported(raw, bbs); err != nil {
+			warns = append(warns, fmt.Sprintf("message %d: %s", count, err))
+			continue
+		}
+		if msg = message.Decode(env, body); msg == nil {
+			warns = append(warns, fmt.Sprintf("message %d: message could not be decoded", count))
+			continue
+		}
+		switch msg.(type) {
+		case *delivrcpt.DeliveryReceipt, *readrcpt.ReadReceipt:
+			receipt = true
+		}
+		if receipt && env.IsReceived() {
+			if _, _, _, err = inc.recordReceipt(env, msg); err != nil {
+				warns = append(warns, fmt.Sprintf("message %d: %s", count, err))
+			}
+			continue
+		}
+		if receipt {
+			// A receipt we sent belongs to the message it was
+			// exported with.
+			if lmi = imported[elmi]; lmi == "" {
+				lmi = last
+			}
+			if lmi == "" {
+				warns = append(warns, fmt.Sprintf("message %d: sent receipt does not follow its message", count))
+			} else if err = inc.SaveReceipt(lmi, env, msg); err != nil {
+				warns = append(warns, fmt.Sprintf("message %d: %s", count, err))
+			}
+			continue
+		}
+		last = ""
+		lmi, rmi := inc.importedMessageIDs(env, msg, elmi)
+		if lmi == "" {
+			if lmi, err = inc.NewMessageID(msgid); err != nil {
+				return lmis, err
+			}
+			if mb := msg.Base(); env.IsReceived() && mb.FDestinationMsgID != nil {
+				*mb.FDestinationMsgID = lmi
+			}
+		}
+		if err = inc.SaveMessage(lmi, rmi, env, msg, false, true); err != nil {
+			return lmis, fmt.Errorf("save imported %s: %s", lmi, err)
+		}
+		if elmi != "" {
+			imported[elmi] = lmi
+		}
+		last = lmi
+		lmis = append(lmis, lmi)
+	}
+	if len(warns) != 0 {
+		return lmis, Warning{errors.New(strings.Join(warns, "\n"))}
+	}
+	return lmis, nil
+}
+
+// parseImported parses a message read from an mbox file.  If it is in the
+// form rendered by ExportMbox (i.e., by envelope.RenderSaved), it is parsed as
+// a saved message, and the LMI recorded by ExportMbox (if any) is returned as
+// well; otherwise, it is parsed as a message retrieved from the specified BBS.
+func parseImported(raw, bbs string) (env *envelope.Envelope, body, lmi string, err error) {
+	if _, saved, ok := strings.Cut(raw, "\n"); ok {
+		if env, body, err = envelope.ParseSaved(saved); err == nil {
+			if first, _, ok := strings.Cut(saved, "\n"); ok {
+				if value, ok := strings.CutPrefix(first, mboxLMIHeader+": "); ok {
+					lmi = strings.TrimSpace(value)
+				}
+			}
+			return env, body, lmi, nil
+		}
+	}
+	env, body, err = envelope.ParseRetrieved(raw, bbs, "")
+	return env, body, "", err
+}
+
+// importedMessageIDs returns the LMI and RMI that an imported message had
+// when it was exported, if they can be determined from the message and the
+// LMI is not already in use.  elmi is the LMI recorded by ExportMbox, if any.
+func (inc *Incident) importedMessageIDs(env *envelope.Envelope, msg message.Message, elmi string) (lmi, rmi string) {
+	var mb = msg.Base()
+
+	if mb.FOriginMsgID != nil && mb.FDestinationMsgID != nil {
+		if env.IsReceived() {
+			lmi, rmi = *mb.FDestinationMsgID, *mb.FOriginMsgID
+		} else {
+			lmi, rmi = *mb.FOriginMsgID, *mb.FDestinationMsgID
+		}
+	} else if mb.FOriginMsgID != nil && !env.IsReceived() {
+		lmi = *mb.FOriginMsgID
+	}
+	if elmi != "" {
+		lmi = elmi
+	}
+	if !MsgIDRE.MatchString(lmi) || inc.UniqueMessageID(lmi) != lmi {
+		lmi = ""
+	}
+	return lmi, rmi
+}
+
+// ExportMbox writes all of the messages in the incident, including receipts,
+// to the supplied writer in mbox format.  Each message is followed by its
+// receipts, so that ImportMbox can match them up; each is marked with the LMI
+// of the message so that ImportMbox can restore it.  Attachments and PDF
+// renderings are not exported.
+func (inc *Incident) ExportMbox(w io.Writer) (err error) {
+	var (
+		mw      = envelope.NewMboxWriter(w)
+		lmis    []string
+		entries []StoreEntry
+	)
+	if lmis, err = inc.AllLMIs(); err != nil {
+		return err
+	}
+	if entries, err = inc.store.List(); err != nil {
+		return err
+	}
+	for _, lmi := range lmis {
+		if err = inc.exportMessage(mw, lmi, ""); err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			rcpt, ok := strings.CutPrefix(entry.Name, lmi+".")
+			if !ok || !strings.HasSuffix(rcpt, ".txt") ||
+				(!strings.HasPrefix(rcpt, "DR") && !strings.HasPrefix(rcpt, "RR")) {
+				continue
+			}
+			if err = inc.exportMessage(mw, lmi, strings.TrimSuffix(rcpt, ".txt")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// exportMessage writes a single message or receipt to the mbox file.
+func (inc *Incident) exportMessage(mw *envelope.MboxWriter, lmi, rcpt string) (err error) {
+	var (
+		env  *envelope.Envelope
+		body string
+	)
+	if env, body, err = inc.readEnvelope(lmi, rcpt); err != nil {
+		return fmt.Errorf("export %s: %s", lmi, err)
+	}
+	if err = mw.Write(env, body, mboxLMIHeader+": "+lmi); err != nil {
+		return fmt.Errorf("export %s: %s", lmi, err)
+	}
+	return nil
+}
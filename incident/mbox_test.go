@@ -0,0 +1,132 @@
+package incident
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+	"github.com/rothskeller/packet/xscmsg/delivrcpt"
+	"github.com/rothskeller/packet/xscmsg/ics213"
+	"github.com/rothskeller/packet/xscmsg/plaintext"
+)
+
+func TestMboxRoundTrip(t *testing.T) {
+	var (
+		src  = New(NewMemoryStore())
+		dst  = New(NewMemoryStore())
+		base = time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+		buf  bytes.Buffer
+	)
+	// A sent plain text message, with a delivery receipt.
+	pt := plaintext.New().(*plaintext.PlainText)
+	pt.OriginMsgID, pt.Subject, pt.Handling, pt.Body = "XND-001P", "Road status", "ROUTINE", "Highway 9 is open.\n"
+	env := &envelope.Envelope{From: "xnd@w1xsc", To: "xsceoc@w1xsc", Date: base}
+	if err := src.SaveMessage("XND-001P", "", env, pt, true, false); err != nil {
+		t.Fatal(err)
+	}
+	denv := &envelope.Envelope{ReceivedBBS: "W1XSC", ReceivedDate: base.Add(time.Minute), From: "xsceoc@w1xsc", To: "xnd@w1xsc", Date: base.Add(time.Minute)}
+	dr := delivrcpt.New()
+	dr.LocalMessageID, dr.DeliveredTime, dr.MessageTo = "SCC-001P", "03/04/2024 10:01", "xsceoc@w1xsc"
+	dr.MessageSubject = env.SubjectLine
+	denv.SubjectLine = dr.EncodeSubject()
+	if err := src.SaveReceipt("XND-001P", denv, dr); err != nil {
+		t.Fatal(err)
+	}
+	// A received ICS-213, with an RMI.
+	form := message.Create("ICS213", "").(*ics213.ICS213v22)
+	form.OriginMsgID, form.DestinationMsgID, form.Handling = "SCC-002P", "XND-002P", "PRIORITY"
+	form.ToICSPosition, form.FromICSPosition = "Planning", "Logistics"
+	form.Subject, form.Message = "Supplies", "Need 50 cots."
+	env = &envelope.Envelope{ReceivedBBS: "W1XSC", ReceivedDate: base.Add(time.Hour), From: "xsceoc@w1xsc", To: "xnd@w1xsc", Date: base.Add(time.Hour)}
+	if err := src.SaveMessage("XND-002P", "SCC-002P", env, form, true, false); err != nil {
+		t.Fatal(err)
+	}
+	// A received plain text message, with the delivery receipt we sent for
+	// it.
+	pt = plaintext.New().(*plaintext.PlainText)
+	pt.OriginMsgID, pt.Subject, pt.Handling, pt.Body = "SCC-003P", "Shelter status", "ROUTINE", "Shelter is open.\n"
+	env = &envelope.Envelope{ReceivedBBS: "W1XSC", ReceivedDate: base.Add(2 * time.Hour), From: "xsceoc@w1xsc", To: "xnd@w1xsc", Date: base.Add(2 * time.Hour)}
+	env.SubjectLine = pt.EncodeSubject()
+	if err := src.SaveMessage("XND-003P", "", env, pt, true, false); err != nil {
+		t.Fatal(err)
+	}
+	dr = delivrcpt.New()
+	dr.LocalMessageID, dr.DeliveredTime, dr.MessageTo = "XND-003P", "03/04/2024 12:00", "xnd@w1xsc"
+	dr.MessageSubject = env.SubjectLine
+	denv = &envelope.Envelope{From: "xnd@w1xsc", To: "xsceoc@w1xsc", Date: base.Add(2 * time.Hour)}
+	denv.SubjectLine = dr.EncodeSubject()
+	if err := src.SaveReceipt("XND-003P", denv, dr); err != nil {
+		t.Fatal(err)
+	}
+	// Export and import.
+	if err := src.ExportMbox(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lmis, err := dst.ImportMbox(&buf, "W9XSC", "XND-100P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"XND-001P", "XND-002P", "XND-003P"}; !reflect.DeepEqual(lmis, want) {
+		t.Fatalf("imported %v, want %v", lmis, want)
+	}
+	// The messages should be restored as they were saved.
+	for _, lmi := range lmis {
+		senv, smsg, err := src.ReadMessage(lmi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		denv, dmsg, err := dst.ReadMessage(lmi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if denv.RenderSaved(dmsg.EncodeBody()) != senv.RenderSaved(smsg.EncodeBody()) {
+			t.Errorf("%s: imported\n%s\nwant\n%s", lmi, denv.RenderSaved(dmsg.EncodeBody()), senv.RenderSaved(smsg.EncodeBody()))
+		}
+	}
+	if got := dst.LMIForRMI("SCC-002P"); got != "XND-002P" {
+		t.Errorf("LMIForRMI(SCC-002P) = %q", got)
+	}
+	// The receipt should be matched up with its message.
+	if _, rmsg, err := dst.ReadReceipt("XND-001P", "DR"); err != nil {
+		t.Errorf("receipt not imported: %s", err)
+	} else if rdr, ok := rmsg.(*delivrcpt.DeliveryReceipt); !ok || rdr.LocalMessageID != "SCC-001P" {
+		t.Errorf("imported receipt %+v", rmsg)
+	}
+	if delivs, err := dst.Deliveries("XND-001P"); err != nil || len(delivs) != 1 || delivs[0].RemoteMessageID != "SCC-001P" {
+		t.Errorf("Deliveries(XND-001P) = %+v, %v", delivs, err)
+	}
+	// The receipt we sent should stay with its message, without creating
+	// a fake sent message for it.
+	if renv, _, err := dst.ReadReceipt("XND-003P", "DR"); err != nil {
+		t.Errorf("sent receipt not imported: %s", err)
+	} else if renv.IsReceived() {
+		t.Errorf("sent receipt imported as received")
+	}
+	if entries, err := dst.store.List(); err != nil {
+		t.Fatal(err)
+	} else {
+		for _, entry := range entries {
+			if entry.Link != "" && entry.Name == "XND-003P.txt" || strings.HasPrefix(entry.Name, "AAA-") {
+				t.Errorf("unexpected %s -> %q after import", entry.Name, entry.Link)
+			}
+		}
+	}
+	// Importing again into the same incident assigns new LMIs.
+	buf.Reset()
+	if err = src.ExportMbox(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if lmis, err = dst.ImportMbox(&buf, "W9XSC", "XND-100P"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"XND-100P", "XND-101P", "XND-102P"}; !reflect.DeepEqual(lmis, want) {
+		t.Errorf("second import %v, want %v", lmis, want)
+	}
+	if _, _, err = dst.ReadReceipt("XND-102P", "DR"); err != nil {
+		t.Errorf("sent receipt not imported with renumbered message: %s", err)
+	}
+}
@@ -0,0 +1,271 @@
+package incident
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+	"github.com/rothskeller/packet/xscmsg/delivrcpt"
+	"github.com/rothskeller/packet/xscmsg/readrcpt"
+)
+
+// ImportOutpost imports messages exported from Outpost Packet Message Manager
+// into the incident, and returns the LMIs of the imported messages.  Each of
+// the named files contains one message, as written by Outpost's message
+// export:  a block of header lines, a blank line, and the message body.  The
+// header lines have the form "Name: value"; the recognized names (matched
+// without regard to case) are
+//
+//	Type                      "Received", "Sent", or "Draft"; if omitted, the
+//	                          message is received if it has a Date Received,
+//	                          sent if it has a Date Sent, and otherwise a draft
+//	From, To, Cc, Subject     as in an email header
+//	BBS                       BBS from which a received message was retrieved
+//	Local Msg ID              local message ID assigned by Outpost
+//	Date Sent                 date the message was sent (by its sender)
+//	Date Received             date a received message was retrieved
+//	Urgent                    "Yes" or "No"
+//	Request Delivery Receipt  "Yes" or "No"
+//	Request Read Receipt      "Yes" or "No"
+//
+// Other header lines are ignored.  Dates may be in Outpost's "01/02/2006
+// 15:04" format (in local time) or in RFC 5322 format.  A sent message must
+// have a Date Sent.  Outpost codes (e.g. "!URG!") at the start of the body are
+// also honored.  Received messages retrieved from an unknown BBS are
+// attributed to the specified bbs.
+//
+// Messages are saved with the local message IDs Outpost assigned to them.  If a
+// message has no local message ID, or it is already in use in the incident, a
+// new one is assigned based on the message ID pattern msgid.  Received
+// receipts are matched against the messages they acknowledge, as if they had
+// just been received.  Receipts that we sent are saved with the received
+// messages they acknowledge, found by local message ID or subject.  Files that
+// cannot be read or parsed are skipped with a Warning, and the import
+// continues.
+func (inc *Incident) ImportOutpost(filenames []string, bbs, msgid string) (lmis []string, err error) {
+	type sentReceipt struct {
+		filename string
+		env      *envelope.Envelope
+		msg      message.Message
+	}
+	var (
+		warns    []string
+		receipts []sentReceipt
+		imported = make(map[string]string)
+		unlock   func()
+	)
+	if inc, unlock, err = inc.lock(); err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	for _, filename := range filenames {
+		var (
+			lmi  string
+			env  *envelope.Envelope
+			body string
+			msg  message.Message
+			data []byte
+		)
+		if data, err = os.ReadFile(filename); err != nil {
+			warns = append(warns, err.Error())
+			continue
+		}
+		if env, body, lmi, err = parseOutpostExport(string(data), bbs); err != nil {
+			warns = append(warns, fmt.Sprintf("%s: %s", filename, err))
+			continue
+		}
+		if msg = message.Decode(env, body); msg == nil {
+			warns = append(warns, fmt.Sprintf("%s: message could not be decoded", filename))
+			continue
+		}
+		switch msg.(type) {
+		case *delivrcpt.DeliveryReceipt, *readrcpt.ReadReceipt:
+			if !env.IsReceived() {
+				// Save these after all of the messages, since
+				// the messages they acknowledge may come later.
+				receipts = append(receipts, sentReceipt{filename, env, msg})
+			} else if _, _, _, err = inc.recordReceipt(env, msg); err != nil {
+				warns = append(warns, fmt.Sprintf("%s: %s", filename, err))
+			}
+			continue
+		}
+		olmi := lmi
+		if !MsgIDRE.MatchString(lmi) || inc.UniqueMessageID(lmi) != lmi {
+			if lmi, err = inc.NewMessageID(msgid); err != nil {
+				return lmis, err
+			}
+		}
+		var rmi string
+		if mb := msg.Base(); env.IsReceived() {
+			if mb.FDestinationMsgID != nil {
+				*mb.FDestinationMsgID = lmi
+			}
+			if mb.FOriginMsgID != nil {
+				rmi = *mb.FOriginMsgID
+			}
+		} else if mb.FDestinationMsgID != nil {
+			rmi = *mb.FDestinationMsgID
+		}
+		if err = inc.SaveMessage(lmi, rmi, env, msg, false, true); err != nil {
+			return lmis, fmt.Errorf("save imported %s: %s", lmi, err)
+		}
+		if olmi != "" {
+			imported[olmi] = lmi
+		}
+		lmis = append(lmis, lmi)
+	}
+	for _, r := range receipts {
+		var lmi string
+
+		if lmi, err = inc.sentReceiptLMI(r.msg, imported); err != nil {
+			return lmis, err
+		}
+		if lmi == "" {
+			warns = append(warns, fmt.Sprintf("%s: no received message for sent receipt", r.filename))
+		} else if err = inc.SaveReceipt(lmi, r.env, r.msg); err != nil {
+			warns = append(warns, fmt.Sprintf("%s: %s", r.filename, err))
+		}
+	}
+	if len(warns) != 0 {
+		return lmis, Warning{errors.New(strings.Join(warns, "\n"))}
+	}
+	return lmis, nil
+}
+
+// sentReceiptLMI returns the LMI of the received message acknowledged by a
+// receipt that we sent, or "" if it can't be found.  imported maps Outpost
+// local message IDs to the LMIs under which their messages were imported.
+func (inc *Incident) sentReceiptLMI(msg message.Message, imported map[string]string) (lmi string, err error) {
+	var subject string
+
+	switch msg := msg.(type) {
+	case *delivrcpt.DeliveryReceipt:
+		if lmi = imported[msg.LocalMessageID]; lmi != "" {
+			return lmi, nil
+		}
+		subject = msg.MessageSubject
+	case *readrcpt.ReadReceipt:
+		subject = msg.MessageSubject
+	}
+	if subject == "" {
+		return "", nil
+	}
+	return inc.subjectToLMI(subject, true)
+}
+
+// parseOutpostExport parses a message file exported from Outpost, returning
+// its envelope, body, and Outpost local message ID.
+func parseOutpostExport(exported, bbs string) (env *envelope.Envelope, body, lmi string, err error) {
+	var (
+		header   string
+		mtype    string
+		received time.Time
+		found    bool
+	)
+	exported = strings.ReplaceAll(exported, "\r\n", "\n")
+	if header, body, found = strings.Cut(exported, "\n\n"); !found {
+		return nil, "", "", errors.New("no blank line after Outpost header")
+	}
+	// Decode any Outpost codes at the start of the body.  The envelope
+	// package does that when parsing a saved message, so we hand it the
+	// body as a saved message with no headers.
+	if env, body, err = envelope.ParseSaved("\n" + body); err != nil {
+		return nil, "", "", err
+	}
+	for _, line := range strings.Split(header, "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, "", "", fmt.Errorf("invalid Outpost header line %q", line)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "type":
+			mtype = strings.ToLower(value)
+		case "from":
+			env.From = value
+		case "to":
+			env.To = value
+		case "cc":
+			env.Cc = value
+		case "subject":
+			env.SubjectLine = value
+		case "bbs":
+			env.ReceivedBBS = value
+		case "local msg id":
+			lmi = value
+		case "date sent":
+			if env.Date, err = parseOutpostDate(value); err != nil {
+				return nil, "", "", err
+			}
+		case "date received":
+			if received, err = parseOutpostDate(value); err != nil {
+				return nil, "", "", err
+			}
+		case "urgent":
+			env.OutpostUrgent = env.OutpostUrgent || outpostYes(value)
+		case "request delivery receipt":
+			env.RequestDeliveryReceipt = env.RequestDeliveryReceipt || outpostYes(value)
+		case "request read receipt":
+			env.RequestReadReceipt = env.RequestReadReceipt || outpostYes(value)
+		}
+	}
+	switch {
+	case mtype == "received" || (mtype == "" && !received.IsZero()):
+		if env.ReceivedBBS == "" {
+			env.ReceivedBBS = bbs
+		}
+		env.ReceivedDate = received
+		if env.ReceivedDate.IsZero() {
+			env.ReceivedDate = env.Date
+		}
+		if env.Date.IsZero() {
+			env.Date = env.ReceivedDate
+		}
+		if addrs, err := envelope.ParseAddressList(env.From); err == nil && len(addrs) != 0 {
+			env.ReturnAddr = addrs[0].Address
+		}
+	case mtype == "draft":
+		env.ReceivedBBS, env.Date = "", time.Time{}
+	case mtype == "sent" || mtype == "":
+		// A message with no Type is sent if it has a Date Sent, and a
+		// draft otherwise.  One that claims to be sent but has no date
+		// can't be recorded as sent, and shouldn't silently become a
+		// draft, which would be sent again.
+		if mtype == "sent" && env.Date.IsZero() {
+			return nil, "", "", errors.New("sent message has no Date Sent")
+		}
+		env.ReceivedBBS = ""
+	default:
+		return nil, "", "", fmt.Errorf("unknown Outpost message type %q", mtype)
+	}
+	return env, body, lmi, nil
+}
+
+// parseOutpostDate parses a date from an Outpost export header.
+func parseOutpostDate(s string) (t time.Time, err error) {
+	if t, err = time.ParseInLocation("01/02/2006 15:04", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err = time.ParseInLocation("01/02/2006 15:04:05", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err = mail.ParseDate(s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid Outpost date %q", s)
+}
+
+// outpostYes returns whether an Outpost export header value is affirmative.
+func outpostYes(s string) bool {
+	switch strings.ToLower(s) {
+	case "yes", "y", "true", "1":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package incident
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseOutpostExport(t *testing.T) {
+	var (
+		sent     = time.Date(2024, 3, 4, 10, 0, 0, 0, time.Local)
+		received = time.Date(2024, 3, 4, 10, 5, 0, 0, time.Local)
+	)
+	for _, tt := range []struct {
+		name         string
+		exported     string
+		err          bool
+		lmi          string
+		date         time.Time
+		receivedBBS  string
+		receivedDate time.Time
+		returnAddr   string
+		urgent       bool
+		body         string
+	}{
+		{
+			name:     "received",
+			exported: "Type: Received\nFrom: A <a@w1xsc>\nTo: b@w2xsc\nSubject: AAA-001P_R_Hi\nBBS: W2XSC\nLocal Msg ID: XND-001P\nDate Sent: 03/04/2024 10:00\nDate Received: 03/04/2024 10:05\n\nHello\n",
+			lmi:      "XND-001P", date: sent, receivedBBS: "W2XSC", receivedDate: received, returnAddr: "a@w1xsc", body: "Hello\n",
+		},
+		{
+			name:     "received default BBS",
+			exported: "Type: Received\nFrom: a@w1xsc\nDate Received: 03/04/2024 10:05\n\nHello\n",
+			date:     received, receivedBBS: "W1XSC", receivedDate: received, returnAddr: "a@w1xsc", body: "Hello\n",
+		},
+		{
+			name:     "received without type",
+			exported: "From: a@w1xsc\nDate Sent: 03/04/2024 10:00\nDate Received: 03/04/2024 10:05\n\nHello\n",
+			date:     sent, receivedBBS: "W1XSC", receivedDate: received, returnAddr: "a@w1xsc", body: "Hello\n",
+		},
+		{
+			name:     "sent",
+			exported: "Type: Sent\r\nFrom: a@w1xsc\r\nTo: b@w2xsc\r\nBBS: W1XSC\r\nDate Sent: 03/04/2024 10:00\r\n\r\n!URG!Hello\r\n",
+			date:     sent, urgent: true, body: "Hello\n",
+		},
+		{
+			name:     "sent RFC 5322 date",
+			exported: "Type: Sent\nDate Sent: Mon, 4 Mar 2024 10:00:00 " + sent.Format("-0700") + "\n\nHello\n",
+			date:     sent, body: "Hello\n",
+		},
+		{
+			name:     "sent without type",
+			exported: "Date Sent: 03/04/2024 10:00\n\nHello\n",
+			date:     sent, body: "Hello\n",
+		},
+		{
+			name:     "sent without date",
+			exported: "Type: Sent\nTo: b@w2xsc\n\nHello\n",
+			err:      true,
+		},
+		{
+			name:     "draft",
+			exported: "Type: Draft\nTo: b@w2xsc\nDate Sent: 03/04/2024 10:00\n\nHello\n",
+			body:     "Hello\n",
+		},
+		{
+			name:     "draft without type",
+			exported: "To: b@w2xsc\n\nHello\n",
+			body:     "Hello\n",
+		},
+		{name: "unknown type", exported: "Type: Deleted\n\nHello\n", err: true},
+		{name: "bad date", exported: "Date Sent: yesterday\n\nHello\n", err: true},
+		{name: "bad header", exported: "Type Sent\n\nHello\n", err: true},
+		{name: "no body", exported: "Type: Sent\n", err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			env, body, lmi, err := parseOutpostExport(tt.exported, "W1XSC")
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lmi != tt.lmi {
+				t.Errorf("lmi = %q, want %q", lmi, tt.lmi)
+			}
+			if !env.Date.Equal(tt.date) {
+				t.Errorf("Date = %v, want %v", env.Date, tt.date)
+			}
+			if env.ReceivedBBS != tt.receivedBBS || !env.ReceivedDate.Equal(tt.receivedDate) {
+				t.Errorf("received = %q %v, want %q %v", env.ReceivedBBS, env.ReceivedDate, tt.receivedBBS, tt.receivedDate)
+			}
+			if env.ReturnAddr != tt.returnAddr {
+				t.Errorf("ReturnAddr = %q, want %q", env.ReturnAddr, tt.returnAddr)
+			}
+			if env.OutpostUrgent != tt.urgent {
+				t.Errorf("OutpostUrgent = %v, want %v", env.OutpostUrgent, tt.urgent)
+			}
+			if body != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+// The files in testdata/outpost are written to the format documented on
+// ImportOutpost; they are not copies of actual Outpost exports.
+func TestImportOutpost(t *testing.T) {
+	var (
+		inc   = New(NewMemoryStore())
+		files []string
+	)
+	// The sent receipt comes first, to show that it is matched with its
+	// message even so.
+	for _, name := range []string{"sent-receipt.txt", "received.txt", "sent.txt", "draft.txt", "sent-nodate.txt"} {
+		files = append(files, filepath.Join("testdata", "outpost", name))
+	}
+	lmis, err := inc.ImportOutpost(files, "W9XSC", "XND-001P")
+	var warn Warning
+	if !errors.As(err, &warn) {
+		t.Errorf("ImportOutpost error = %v, want Warning for sent-nodate.txt", err)
+	}
+	if want := []string{"XND-101P", "XND-102P", "XND-103P"}; !reflect.DeepEqual(lmis, want) {
+		t.Fatalf("lmis = %v, want %v", lmis, want)
+	}
+	// The received message.
+	env, _, err := inc.ReadMessage("XND-101P")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !env.IsReceived() || env.ReceivedBBS != "W1XSC" || !env.RequestDeliveryReceipt {
+		t.Errorf("received message envelope %+v", env)
+	}
+	if want := time.Date(2024, 3, 4, 9, 20, 0, 0, time.Local); !env.ReceivedDate.Equal(want) {
+		t.Errorf("received message ReceivedDate = %v, want %v", env.ReceivedDate, want)
+	}
+	if got := inc.LMIForRMI("SCC-123P"); got != "XND-101P" {
+		t.Errorf("LMIForRMI(SCC-123P) = %q", got)
+	}
+	// The delivery receipt we sent for it, without a fake sent message.
+	if env, _, err = inc.ReadReceipt("XND-101P", "DR"); err != nil {
+		t.Errorf("sent receipt not imported: %s", err)
+	} else if env.IsReceived() {
+		t.Error("sent receipt imported as received")
+	}
+	if all, err := inc.AllLMIs(); err != nil || !reflect.DeepEqual(all, lmis) {
+		t.Errorf("AllLMIs = %v, %v; want %v", all, err, lmis)
+	}
+	// The sent message.
+	if env, _, err = inc.ReadMessage("XND-102P"); err != nil {
+		t.Fatal(err)
+	}
+	if env.IsReceived() || !env.IsFinal() || !env.OutpostUrgent || env.Cc != "xndeoc@w2xsc.ampr.org" || !env.RequestReadReceipt {
+		t.Errorf("sent message envelope %+v", env)
+	}
+	// The draft message.
+	if env, _, err = inc.ReadMessage("XND-103P"); err != nil {
+		t.Fatal(err)
+	}
+	if env.IsReceived() || env.IsFinal() {
+		t.Errorf("draft message envelope %+v", env)
+	}
+	// The sent message without a date was not imported.
+	if inc.MessageExists("XND-104P") {
+		t.Error("sent message without date was imported")
+	}
+	// Importing again assigns new LMIs, since the Outpost ones are taken.
+	if lmis, err = inc.ImportOutpost(files[1:2], "W9XSC", "XND-001P"); err != nil || !reflect.DeepEqual(lmis, []string{"XND-001P"}) {
+		t.Errorf("second import = %v, %v", lmis, err)
+	}
+}
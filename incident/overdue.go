@@ -0,0 +1,127 @@
+package incident
+
+import (
+	"sort"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+)
+
+// DeliveryTimeouts gives, for each handling order, how long after a message is
+// sent a delivery receipt for it should be expected.  A zero timeout means
+// that messages with that handling order are not tracked.
+type DeliveryTimeouts struct {
+	Immediate time.Duration
+	Priority  time.Duration
+	Routine   time.Duration
+}
+
+// DefaultDeliveryTimeouts are the timeouts used by OverdueDeliveries if none
+// are specified.  They are based on the delivery expectations of the Santa
+// Clara County handling orders.
+var DefaultDeliveryTimeouts = DeliveryTimeouts{
+	Immediate: 15 * time.Minute,
+	Priority:  time.Hour,
+	Routine:   2 * time.Hour,
+}
+
+// timeout returns the timeout for the specified handling order.
+func (dt *DeliveryTimeouts) timeout(handling string) time.Duration {
+	switch handling {
+	case "IMMEDIATE":
+		return dt.Immediate
+	case "PRIORITY":
+		return dt.Priority
+	default:
+		return dt.Routine
+	}
+}
+
+// An OverdueDelivery describes one recipient of a sent message from whom no
+// delivery receipt has been received within the timeout for the message's
+// handling order.
+type OverdueDelivery struct {
+	// LMI is the local message ID of the sent message.
+	LMI string
+	// Subject is the subject line of the sent message.
+	Subject string
+	// Handling is the handling order of the sent message:  "IMMEDIATE",
+	// "PRIORITY", or "ROUTINE".
+	Handling string
+	// Sent is the time the message was sent.
+	Sent time.Time
+	// Due is the time by which a delivery receipt was expected.
+	Due time.Time
+	// Recipient and Header identify the recipient, as in DeliveryInfo.
+	Recipient string
+	Header    string
+}
+
+// OverdueDeliveries returns a list of the recipients of sent messages from
+// whom no delivery receipt has been received within the timeout for the
+// message's handling order, so that the messages can be resent or followed up
+// some other way.  Messages without a handling order are treated as ROUTINE
+// unless Outpost considers them urgent, in which case they are treated as
+// IMMEDIATE.  Bulletins are not tracked, since they don't get delivery
+// receipts.  If timeouts is nil, DefaultDeliveryTimeouts is used.  The list is
+// sorted by due time, oldest first.  An error is returned only if the incident
+// cannot be read.
+func (inc *Incident) OverdueDeliveries(timeouts *DeliveryTimeouts) (overdue []*OverdueDelivery, err error) {
+	var (
+		lmis []string
+		now  = time.Now()
+	)
+	if timeouts == nil {
+		timeouts = &DefaultDeliveryTimeouts
+	}
+	if lmis, err = inc.AllLMIs(); err != nil {
+		return nil, err
+	}
+	for _, lmi := range lmis {
+		var (
+			env      *envelope.Envelope
+			msg      message.Message
+			delivs   []*DeliveryInfo
+			handling string
+			due      time.Time
+		)
+		if env, msg, err = inc.ReadMessage(lmi); err != nil {
+			continue // not our problem here
+		}
+		if env.IsReceived() || !env.IsFinal() || env.Bulletin {
+			continue
+		}
+		if mb := msg.Base(); mb.FHandling != nil && *mb.FHandling != "" {
+			handling = *mb.FHandling
+		} else if env.OutpostUrgent {
+			handling = "IMMEDIATE"
+		} else {
+			handling = "ROUTINE"
+		}
+		if timeout := timeouts.timeout(handling); timeout == 0 {
+			continue
+		} else if due = env.Date.Add(timeout); now.Before(due) {
+			continue
+		}
+		if delivs, err = inc.Deliveries(lmi); err != nil {
+			continue
+		}
+		for _, deliv := range delivs {
+			if deliv.Recipient == "" || deliv.DeliveredTime != "" {
+				continue
+			}
+			overdue = append(overdue, &OverdueDelivery{
+				LMI:       lmi,
+				Subject:   env.SubjectLine,
+				Handling:  handling,
+				Sent:      env.Date,
+				Due:       due,
+				Recipient: deliv.Recipient,
+				Header:    deliv.Header,
+			})
+		}
+	}
+	sort.SliceStable(overdue, func(i, j int) bool { return overdue[i].Due.Before(overdue[j].Due) })
+	return overdue, nil
+}
@@ -0,0 +1,56 @@
+package incident
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/xscmsg/delivrcpt"
+	"github.com/rothskeller/packet/xscmsg/plaintext"
+)
+
+func TestOverdueDeliveries(t *testing.T) {
+	var (
+		inc  = New(NewMemoryStore())
+		sent = time.Now().Add(-90 * time.Minute)
+	)
+	for _, tt := range []struct {
+		lmi    string
+		urgent bool
+	}{{"XND-001P", false}, {"XND-002P", true}} {
+		env := &envelope.Envelope{From: "a@w1xsc", To: "b@w1xsc, c@w2xsc", Date: sent, OutpostUrgent: tt.urgent}
+		msg := plaintext.New().(*plaintext.PlainText)
+		msg.Subject = "Hello"
+		if tt.urgent {
+			msg.Handling = "IMMEDIATE"
+		}
+		if err := inc.SaveMessage(tt.lmi, "", env, msg, true, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	denv := &envelope.Envelope{ReceivedBBS: "W1XSC", ReceivedDate: time.Now(), From: "b@w1xsc", To: "a@w1xsc", Date: time.Now()}
+	dr := delivrcpt.New()
+	dr.LocalMessageID, dr.DeliveredTime, dr.MessageTo = "AAA-001P", "01/02/2024 15:04", "b@w1xsc"
+	dr.MessageSubject = "_I_Hello"
+	denv.SubjectLine = dr.EncodeSubject()
+	if err := inc.SaveReceipt("XND-002P", denv, dr); err != nil {
+		t.Fatal(err)
+	}
+	// The ROUTINE message isn't overdue yet, and one of the IMMEDIATE
+	// recipients has acknowledged.
+	overdue, err := inc.OverdueDeliveries(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overdue) != 1 || overdue[0].LMI != "XND-002P" || overdue[0].Recipient != "c@w2xsc" || overdue[0].Handling != "IMMEDIATE" {
+		t.Errorf("overdue = %+v", overdue)
+	}
+	// With shorter timeouts, both ROUTINE recipients are overdue too.
+	overdue, err = inc.OverdueDeliveries(&DeliveryTimeouts{Routine: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overdue) != 2 || overdue[0].LMI != "XND-001P" || overdue[1].LMI != "XND-001P" {
+		t.Errorf("overdue with short timeouts = %+v", overdue)
+	}
+}
@@ -0,0 +1,46 @@
+package incident
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/rothskeller/packet/envelope"
+)
+
+// SendQueue returns the LMIs of the outgoing messages that are queued for
+// sending (i.e., not yet transmitted and not drafts), in the order they should
+// be sent:  highest priority first, and in chronological order within each
+// priority.  Each queued message is checked with envelope.CheckSend.  Those
+// that have expired are not included in lmis; instead, their LMIs are returned
+// in expired, so that the caller can report them.  (They remain queued until
+// the caller changes them.)  Any others that CheckSend refuses are skipped.  An
+// error is returned only if the directory cannot be read.
+func (inc *Incident) SendQueue() (lmis, expired []string, err error) {
+	var (
+		all  []string
+		envs = make(map[string]*envelope.Envelope)
+	)
+	if all, err = inc.AllLMIs(); err != nil {
+		return nil, nil, err
+	}
+	for _, lmi := range all {
+		env, _, err := inc.readEnvelope(lmi, "")
+		if err != nil || env.IsReceived() || env.IsFinal() || !env.ReadyToSend {
+			continue
+		}
+		if err := env.CheckSend(); errors.Is(err, envelope.ErrExpired) {
+			expired = append(expired, lmi)
+			continue
+		} else if err != nil {
+			continue
+		}
+		envs[lmi] = env
+		lmis = append(lmis, lmi)
+	}
+	// AllLMIs returns them in chronological order, so a stable sort by
+	// priority gives the order we want.
+	sort.SliceStable(lmis, func(i, j int) bool {
+		return envs[lmis[i]].Priority > envs[lmis[j]].Priority
+	})
+	return lmis, expired, nil
+}
@@ -0,0 +1,53 @@
+package incident
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/xscmsg/plaintext"
+)
+
+func TestSendQueue(t *testing.T) {
+	var inc = New(NewMemoryStore())
+
+	for _, tt := range []struct {
+		lmi      string
+		ready    bool
+		sent     bool
+		priority envelope.Priority
+		expires  time.Duration
+	}{
+		{lmi: "XND-001P", ready: true},
+		{lmi: "XND-002P", ready: true, priority: envelope.PriorityHigh},
+		{lmi: "XND-003P", ready: true, priority: envelope.PriorityHigh, expires: -time.Minute},
+		{lmi: "XND-004P"}, // draft
+		{lmi: "XND-005P", ready: true, sent: true},
+		{lmi: "XND-006P", ready: true, priority: envelope.PriorityLow},
+		{lmi: "XND-007P", ready: true, expires: time.Hour},
+	} {
+		env := &envelope.Envelope{To: "b@w2xsc", ReadyToSend: tt.ready, Priority: tt.priority}
+		if tt.sent {
+			env.Date = time.Now()
+		}
+		if tt.expires != 0 {
+			env.Expires = time.Now().Add(tt.expires)
+		}
+		msg := plaintext.New().(*plaintext.PlainText)
+		msg.OriginMsgID, msg.Subject, msg.Handling, msg.Body = tt.lmi, "Hello", "ROUTINE", "Hello, world."
+		if err := inc.SaveMessage(tt.lmi, "", env, msg, true, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lmis, expired, err := inc.SendQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"XND-002P", "XND-001P", "XND-007P", "XND-006P"}; !reflect.DeepEqual(lmis, want) {
+		t.Errorf("lmis = %v, want %v", lmis, want)
+	}
+	if want := []string{"XND-003P"}; !reflect.DeepEqual(expired, want) {
+		t.Errorf("expired = %v, want %v", expired, want)
+	}
+}
@@ -3,7 +3,7 @@ package incident
 import (
 	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"strings"
 	"time"
 
@@ -39,9 +39,16 @@ func (w Warning) Unwrap() error { return w.err }
 // If the received message has an error, "err" will be set and the other return
 // values will be zero.  If the received message has a warning, "err" will be
 // set to a Warning value, and the other return values will be set as above.
-func ReceiveMessage(raw, bbs, area, msgid, opcall, opname string) (
+func (inc *Incident) ReceiveMessage(raw, bbs, area, msgid, opcall, opname string) (
 	lmi string, env *envelope.Envelope, msg message.Message, oenv *envelope.Envelope, omsg message.Message, err error,
 ) {
+	// Lock the incident so that the LMI we assign can't be taken by
+	// another process before we save the message.
+	var unlock func()
+	if inc, unlock, err = inc.lock(); err != nil {
+		return
+	}
+	defer unlock()
 	// Parse the message.
 	var body string
 	env, body, err = envelope.ParseRetrieved(raw, bbs, area)
@@ -56,12 +63,15 @@ func ReceiveMessage(raw, bbs, area, msgid, opcall, opname string) (
 	// If it's a receipt, it's handled specially.
 	switch msg.(type) {
 	case *delivrcpt.DeliveryReceipt, *readrcpt.ReadReceipt:
-		lmi, oenv, omsg, err = recordReceipt(env, msg)
+		lmi, oenv, omsg, err = inc.recordReceipt(env, msg)
 		return
 	}
 	// Assign a local message ID.  Put it, and the opcall/opname, into the
 	// message if it has fields for it.
-	lmi = UniqueMessageID(msgid)
+	var err2 error
+	if lmi, err2 = inc.NewMessageID(msgid); err2 != nil {
+		return "", nil, nil, nil, nil, fmt.Errorf("assign LMI: %s", err2)
+	}
 	if mb := msg.Base(); mb.FDestinationMsgID != nil {
 		*mb.FDestinationMsgID = lmi
 	}
@@ -71,7 +81,7 @@ func ReceiveMessage(raw, bbs, area, msgid, opcall, opname string) (
 	if b := msg.Base(); b.FOriginMsgID != nil {
 		rmi = *b.FOriginMsgID
 	}
-	if err2 := SaveMessage(lmi, rmi, env, msg, false, true); err2 != nil {
+	if err2 = inc.SaveMessage(lmi, rmi, env, msg, false, true); err2 != nil {
 		err = fmt.Errorf("save received %s: %s", lmi, err2)
 		return
 	}
@@ -90,9 +100,66 @@ func ReceiveMessage(raw, bbs, area, msgid, opcall, opname string) (
 	return lmi, env, msg, denv, dr, err
 }
 
+// MarkRead records that the received message with the specified LMI has been
+// read by an operator, and should be called when the operator first opens it.
+// The read time is saved in the message's ReadDate.  If this is the first time
+// the message was read, and its sender requested a read receipt, the envelope
+// and message for that receipt are returned in "oenv" and "omsg", and the
+// caller should send them.  Otherwise, those return values are nil.  lmi may
+// also be an RMI of the message.
+func (inc *Incident) MarkRead(lmi string) (oenv *envelope.Envelope, omsg message.Message, err error) {
+	var (
+		env    *envelope.Envelope
+		body   string
+		unlock func()
+	)
+	if inc, unlock, err = inc.lock(); err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+	if !MsgIDRE.MatchString(lmi) {
+		return nil, nil, errors.New("invalid LMI")
+	}
+	if entry, err := inc.store.Stat(lmi + ".txt"); err != nil || entry.Link != "" {
+		if target := inc.LMIForRMI(lmi); target != "" {
+			lmi = target
+		}
+	}
+	if env, body, err = inc.readEnvelope(lmi, ""); err != nil {
+		return nil, nil, err
+	}
+	if !env.IsReceived() {
+		return nil, nil, fmt.Errorf("%s: not a received message", lmi)
+	}
+	if !env.ReadDate.IsZero() {
+		return nil, nil, nil // already read
+	}
+	// Save the read time.  This goes through SaveMessage like any other
+	// change, so that the PDF, ICS-309, and search index stay consistent
+	// with the message.  The PDF is regenerated only if the message had
+	// one already.
+	env.ReadDate = time.Now()
+	_, err = inc.store.Stat(lmi + ".pdf")
+	if err = inc.SaveMessage(lmi, "", env, message.Decode(env, body), err != nil, true); err != nil {
+		return nil, nil, err
+	}
+	if !env.RequestReadReceipt {
+		return nil, nil, nil
+	}
+	// Return read receipt.
+	rr := readrcpt.New()
+	rr.ReadTime = env.ReadDate.Format("01/02/2006 15:04")
+	rr.MessageSubject = env.SubjectLine
+	rr.MessageTo = env.To
+	oenv = new(envelope.Envelope)
+	oenv.SubjectLine = rr.EncodeSubject()
+	oenv.To = env.From
+	return oenv, rr, nil
+}
+
 // recordReceipt matches a received receipt with the corresponding outgoing
 // message.
-func recordReceipt(env *envelope.Envelope, msg message.Message) (
+func (inc *Incident) recordReceipt(env *envelope.Envelope, msg message.Message) (
 	lmi string, oenv *envelope.Envelope, omsg message.Message, err error,
 ) {
 	var (
@@ -108,23 +175,23 @@ func recordReceipt(env *envelope.Envelope, msg message.Message) (
 		subject, to = msg.MessageSubject, msg.MessageTo
 	}
 	if subject != "" {
-		if lmi, err = subjectToLMI(subject); err != nil {
+		if lmi, err = inc.subjectToLMI(subject, false); err != nil {
 			return "", nil, nil, err
 		}
 	}
 	if lmi == "" {
-		if lmi, err = makeFakeSentMessage(subject, to, env); err != nil {
+		if lmi, err = inc.makeFakeSentMessage(subject, to, env); err != nil {
 			return "", nil, nil, err
 		}
 	}
 	if lmi == "" {
 		return
 	}
-	if oenv, omsg, err = ReadMessage(lmi); err != nil {
+	if oenv, omsg, err = inc.ReadMessage(lmi); err != nil {
 		err = fmt.Errorf("read message %s for receipt: %s", lmi, err)
 		return
 	}
-	if err = SaveReceipt(lmi, env, msg); err != nil {
+	if err = inc.SaveReceipt(lmi, env, msg); err != nil {
 		err = fmt.Errorf("save receipt for %s: %s", lmi, err)
 		return
 	}
@@ -134,38 +201,39 @@ func recordReceipt(env *envelope.Envelope, msg message.Message) (
 	if mb := msg.Base(); mb.FDestinationMsgID != nil && *mb.FDestinationMsgID == "" {
 		*mb.FDestinationMsgID = rmi
 	}
-	if err = SaveMessage(lmi, rmi, oenv, omsg, false, false); err != nil {
+	if err = inc.SaveMessage(lmi, rmi, oenv, omsg, false, false); err != nil {
 		err = fmt.Errorf("add RMI: save message %s: %s", lmi, err)
 		return
 	}
 	return
 }
 
-// subjectToLMI scans all sent messages in reverse chronological order looking
-// for one with the specified subject.  If found, it returns the LMI.
-func subjectToLMI(subject string) (lmi string, err error) {
-	lmis, err := AllLMIs()
+// subjectToLMI scans all sent (or, if received is true, received) messages in
+// reverse chronological order looking for one with the specified subject.  If
+// found, it returns the LMI.
+func (inc *Incident) subjectToLMI(subject string, received bool) (lmi string, err error) {
+	lmis, err := inc.AllLMIs()
 	if err != nil {
 		return "", err
 	}
 	for i := len(lmis) - 1; i >= 0; i-- {
 		lmi = lmis[i]
-		if env, _, err := readEnvelope(lmi, ""); err == nil &&
-			!env.IsReceived() && env.IsFinal() && env.SubjectLine == subject {
+		if env, _, err := inc.readEnvelope(lmi, ""); err == nil &&
+			env.IsReceived() == received && env.IsFinal() && env.SubjectLine == subject {
 			return lmi, nil
 		}
 	}
 	return "", nil
 }
 
-func makeFakeSentMessage(subject, to string, rcptenv *envelope.Envelope) (lmi string, err error) {
+func (inc *Incident) makeFakeSentMessage(subject, to string, rcptenv *envelope.Envelope) (lmi string, err error) {
 	// Can we discern an LMI from the subject line of the message being
 	// receipted?
 	if lmi, _, _, _, _ = message.DecodeSubject(subject); !MsgIDRE.MatchString(lmi) {
 		return "", nil
 	}
 	// Is that LMI available?  We don't already have something named that?
-	if _, err = os.Stat(lmi + ".txt"); !errors.Is(err, os.ErrNotExist) {
+	if _, err = inc.store.Stat(lmi + ".txt"); !errors.Is(err, fs.ErrNotExist) {
 		return "", nil
 	}
 	// Create a fake sent message.
@@ -180,13 +248,8 @@ A receipt was received for a message with this ID, but that message was sent
 in a different incident or by different software.
 `)
 	// Save the message to its text file.
-	if err = os.WriteFile(lmi+".txt", []byte(content), 0666); err != nil {
+	if err = inc.store.WriteFile(lmi+".txt", []byte(content)); err != nil {
 		return "", err
 	}
-	// Set the modification time of the text file based on the envelope.
-	// (This allows AllLMIs to sort by file modification time.)
-	if !env.Date.IsZero() {
-		os.Chtimes(lmi+".txt", env.Date, env.Date) // error ignored
-	}
 	return lmi, nil
 }
@@ -0,0 +1,77 @@
+package incident
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rothskeller/packet/xscmsg/readrcpt"
+)
+
+func TestMarkRead(t *testing.T) {
+	const raw = "From: <nobody@nowhere>\nTo: <somebody@somewhere>\nSubject: AAA-001P_R_Hello\nDate: Wed, 1 Dec 2021 08:04:29 +0000\n\n!RRR!nothing\n"
+	inc := New(NewMemoryStore())
+	lmi, _, _, _, _, err := inc.ReceiveMessage(raw, "W1XSC", "", "XND-001P", "KC6RSC", "Steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oenv, omsg, err := inc.MarkRead(lmi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr, ok := omsg.(*readrcpt.ReadReceipt); !ok {
+		t.Fatalf("MarkRead returned %T, expected read receipt", omsg)
+	} else if rr.MessageSubject != "AAA-001P_R_Hello" || rr.ReadTime == "" {
+		t.Errorf("incorrect read receipt %+v", rr)
+	}
+	if oenv.To != "nobody@nowhere" || oenv.SubjectLine != "READ: AAA-001P_R_Hello" {
+		t.Errorf("incorrect read receipt envelope %+v", oenv)
+	}
+	env, _, err := inc.ReadMessage(lmi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ReadDate.IsZero() || !env.RequestReadReceipt {
+		t.Errorf("read flag not saved: %+v", env)
+	}
+	// A second MarkRead does not generate another receipt.
+	if oenv, omsg, err = inc.MarkRead(lmi); err != nil || oenv != nil || omsg != nil {
+		t.Errorf("second MarkRead returned %v, %v, %v", oenv, omsg, err)
+	}
+}
+
+func TestMarkReadCheck(t *testing.T) {
+	const raw = "From: <nobody@nowhere>\nTo: <somebody@somewhere>\nSubject: AAA-001P_R_Hello\nDate: Wed, 1 Dec 2021 08:04:29 +0000\n\nHello, world.\n"
+	inc := New(NewMemoryStore())
+	lmi, _, _, _, _, err := inc.ReceiveMessage(raw, "W1XSC", "", "XND-001P", "KC6RSC", "Steve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Pretend the message has a rendered PDF, whether or not PDF support
+	// is built in.
+	if err = inc.store.WriteFile(lmi+".pdf", []byte("%PDF")); err != nil {
+		t.Fatal(err)
+	}
+	if err = inc.GenerateICS309(&ICS309Header{}); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := inc.Check(false); err != nil || len(problems) != 0 {
+		t.Fatalf("before MarkRead: Check returned %v, %v", problems, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	// Mark it read by its RMI.
+	if _, _, err = inc.MarkRead("AAA-001P"); err != nil {
+		t.Fatal(err)
+	}
+	if problems, err := inc.Check(false); err != nil || len(problems) != 0 {
+		t.Errorf("after MarkRead: Check returned %v, %v", problems, err)
+	}
+	if _, err = inc.store.Stat("ics309.csv"); err == nil {
+		t.Error("ICS-309 not removed by MarkRead")
+	}
+	if env, _, err := inc.ReadMessage(lmi); err != nil || env.ReadDate.IsZero() {
+		t.Errorf("read date not saved: %v, %v", env, err)
+	}
+	if results, err := inc.Search(&SearchQuery{Text: "hello"}); err != nil || len(results) != 1 || results[0].LMI != lmi {
+		t.Errorf("Search returned %v, %v", results, err)
+	}
+}
@@ -0,0 +1,221 @@
+package incident
+
+// This file contains the handling of the RMI index, which replaces RMI
+// symbolic links in incidents stored on file systems that don't support them.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// rmiIndexFile is the name of the file containing the RMI index.  Its presence
+// is what marks an incident as using IndexLayout.
+const rmiIndexFile = "rmi-index.txt"
+
+// A Layout identifies how an incident records the mapping from the remote
+// message IDs of its messages to their local message IDs.
+type Layout uint8
+
+// Values for Layout:
+const (
+	// SymlinkLayout records each RMI as a symbolic link «RMI».txt pointing
+	// to «LMI».txt, with a similar link «RMI».pdf pointing to «LMI».pdf if
+	// there is a PDF rendering.  This is the default layout.
+	SymlinkLayout Layout = iota
+	// IndexLayout records the RMIs in a single index file, rmi-index.txt,
+	// with one "«RMI» «LMI»" pair per line.  There are no «RMI».pdf
+	// aliases.  This layout is suitable for file systems (e.g. FAT) that
+	// do not support symbolic links.
+	IndexLayout
+)
+
+func (l Layout) String() string {
+	switch l {
+	case SymlinkLayout:
+		return "symlink"
+	case IndexLayout:
+		return "index"
+	}
+	return fmt.Sprintf("Layout(%d)", l)
+}
+
+// RMILayout returns the layout the incident uses for recording RMIs.
+func (inc *Incident) RMILayout() Layout {
+	if _, err := inc.store.Stat(rmiIndexFile); err == nil {
+		return IndexLayout
+	}
+	return SymlinkLayout
+}
+
+// ConvertLayout converts the incident to the specified RMI layout.  It does
+// nothing if the incident already uses that layout.  Converting an empty
+// incident to IndexLayout is how an incident is set up to use it from the
+// start.  If the conversion fails part way through, the incident remains in
+// its original layout, although it may contain some of the converted RMI
+// records as well.
+func (inc *Incident) ConvertLayout(to Layout) (err error) {
+	var unlock func()
+
+	if inc, unlock, err = inc.lock(); err != nil {
+		return err
+	}
+	defer unlock()
+
+	if inc.RMILayout() == to {
+		return nil
+	}
+	switch to {
+	case SymlinkLayout:
+		return inc.convertToSymlinks()
+	case IndexLayout:
+		return inc.convertToIndex()
+	}
+	return fmt.Errorf("unknown layout %s", to)
+}
+
+// convertToSymlinks converts the incident from IndexLayout to SymlinkLayout.
+func (inc *Incident) convertToSymlinks() (err error) {
+	var index map[string]string
+
+	if index, err = inc.readRMIIndex(); err != nil {
+		return err
+	}
+	for rmi, lmi := range index {
+		if err = inc.convertLink(lmi+".txt", rmi+".txt"); err != nil {
+			return err
+		}
+		if _, err = inc.store.Stat(lmi + ".pdf"); err == nil {
+			if err = inc.convertLink(lmi+".pdf", rmi+".pdf"); err != nil {
+				return err
+			}
+		}
+	}
+	return inc.store.Remove(rmiIndexFile)
+}
+
+// convertLink creates a link from name to target, unless one already exists.
+func (inc *Incident) convertLink(target, name string) (err error) {
+	if entry, err := inc.store.Stat(name); err == nil {
+		if entry.Link == target {
+			return nil
+		}
+		return fmt.Errorf("%s: already exists", name)
+	}
+	return inc.store.Link(target, name)
+}
+
+// convertToIndex converts the incident from SymlinkLayout to IndexLayout.
+func (inc *Incident) convertToIndex() (err error) {
+	var (
+		entries []StoreEntry
+		index   = make(map[string]string)
+	)
+	if entries, err = inc.store.List(); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		rmi, ok1 := strings.CutSuffix(entry.Name, ".txt")
+		lmi, ok2 := strings.CutSuffix(entry.Link, ".txt")
+		if ok1 && ok2 && MsgIDRE.MatchString(rmi) && MsgIDRE.MatchString(lmi) {
+			index[rmi] = lmi
+		}
+	}
+	if err = inc.writeRMIIndex(index); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Link == "" {
+			continue
+		}
+		if rmi, ok := strings.CutSuffix(entry.Name, ".pdf"); ok && index[rmi] != "" {
+			inc.store.Remove(entry.Name)
+		} else if rmi, ok = strings.CutSuffix(entry.Name, ".txt"); ok && index[rmi] != "" {
+			inc.store.Remove(entry.Name)
+		}
+	}
+	return nil
+}
+
+// readRMIIndex reads the RMI index and returns it as a map from RMI to LMI.
+// It returns a nil map (and no error) if the incident does not use
+// IndexLayout.
+func (inc *Incident) readRMIIndex() (index map[string]string, err error) {
+	var data []byte
+
+	if data, err = inc.store.ReadFile(rmiIndexFile); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	index = make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		rmi, lmi, ok := strings.Cut(line, " ")
+		lmi = strings.TrimSpace(lmi)
+		if !ok || !MsgIDRE.MatchString(rmi) || !MsgIDRE.MatchString(lmi) {
+			return nil, fmt.Errorf("%s:%d: invalid RMI index line", rmiIndexFile, i+1)
+		}
+		index[rmi] = lmi
+	}
+	return index, nil
+}
+
+// writeRMIIndex writes the RMI index.
+func (inc *Incident) writeRMIIndex(index map[string]string) error {
+	var (
+		rmis []string
+		sb   strings.Builder
+	)
+	for rmi := range index {
+		rmis = append(rmis, rmi)
+	}
+	sort.Strings(rmis)
+	for _, rmi := range rmis {
+		fmt.Fprintf(&sb, "%s %s\n", rmi, index[rmi])
+	}
+	return inc.store.WriteFile(rmiIndexFile, []byte(sb.String()))
+}
+
+// indexRMI adds an RMI to the RMI index, unless the index already has an entry
+// for it.
+func (inc *Incident) indexRMI(rmi, lmi string) (err error) {
+	var index map[string]string
+
+	if index, err = inc.readRMIIndex(); err != nil {
+		return err
+	}
+	if index == nil {
+		index = make(map[string]string)
+	}
+	if _, ok := index[rmi]; ok {
+		return nil
+	}
+	index[rmi] = lmi
+	return inc.writeRMIIndex(index)
+}
+
+// unindexLMI removes any RMI index entries for the specified LMI.  It does
+// nothing if the incident does not use IndexLayout.  Errors are ignored, since
+// Check will find and remove any stale entries.
+func (inc *Incident) unindexLMI(lmi string) {
+	var changed bool
+
+	index, err := inc.readRMIIndex()
+	if err != nil || index == nil {
+		return
+	}
+	for rmi, target := range index {
+		if target == lmi {
+			delete(index, rmi)
+			changed = true
+		}
+	}
+	if changed {
+		inc.writeRMIIndex(index)
+	}
+}
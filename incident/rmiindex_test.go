@@ -0,0 +1,117 @@
+package incident
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/xscmsg/plaintext"
+)
+
+// saveRMIMessage saves a message with the specified LMI and RMI, with a PDF
+// rendering.
+func saveRMIMessage(t *testing.T, inc *Incident, lmi, rmi string) {
+	var (
+		env = &envelope.Envelope{ReceivedBBS: "W1XSC", ReceivedDate: time.Now(), From: "a@b", To: "c@d", Date: time.Now()}
+		msg = plaintext.New().(*plaintext.PlainText)
+	)
+	msg.OriginMsgID, msg.Subject, msg.Handling, msg.Body = rmi, "Hello", "ROUTINE", "Hello, world."
+	if err := inc.SaveMessage(lmi, rmi, env, msg, false, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkRMILookups verifies that the RMI lookups work for the messages saved
+// by testRMILayout, whatever the layout.
+func checkRMILookups(t *testing.T, inc *Incident, layout Layout) {
+	if got := inc.RMILayout(); got != layout {
+		t.Errorf("RMILayout() = %s, want %s", got, layout)
+	}
+	for rmi, lmi := range map[string]string{"AAA-005P": "XND-001P", "AAA-006P": "XND-002P", "XND-001P": ""} {
+		if got := inc.LMIForRMI(rmi); got != lmi {
+			t.Errorf("%s: LMIForRMI(%s) = %q, want %q", layout, rmi, got, lmi)
+		}
+	}
+	if !inc.MessageExists("AAA-006P") {
+		t.Errorf("%s: MessageExists(AAA-006P) = false", layout)
+	}
+	if env, _, err := inc.ReadMessage("AAA-005P"); err != nil || env.ReceivedBBS != "W1XSC" {
+		t.Errorf("%s: ReadMessage(AAA-005P) = %v, %v", layout, env, err)
+	}
+	for _, tt := range []struct {
+		seq    int
+		remote bool
+		want   []string
+	}{
+		{1, false, []string{"XND-001P"}},
+		{5, false, nil},
+		{5, true, []string{"XND-001P"}},
+		{6, true, []string{"XND-002P"}},
+	} {
+		got, err := inc.SeqToLMI(tt.seq, tt.remote)
+		sort.Strings(got)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: SeqToLMI(%d, %v) = %v, %v; want %v", layout, tt.seq, tt.remote, got, err, tt.want)
+		}
+	}
+}
+
+func testRMILayout(t *testing.T, store Store) {
+	defer stubPlainPDF()()
+	inc := New(store)
+	saveRMIMessage(t, inc, "XND-001P", "AAA-005P")
+	saveRMIMessage(t, inc, "XND-002P", "AAA-006P")
+	checkRMILookups(t, inc, SymlinkLayout)
+	// Convert to the index layout.  The symlinks are replaced by index
+	// entries.
+	if err := inc.ConvertLayout(IndexLayout); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"AAA-005P.txt", "AAA-005P.pdf", "AAA-006P.txt", "AAA-006P.pdf"} {
+		if _, err := store.Stat(name); err == nil {
+			t.Errorf("%s not removed by conversion to index layout", name)
+		}
+	}
+	if data, _ := store.ReadFile(rmiIndexFile); string(data) != "AAA-005P XND-001P\nAAA-006P XND-002P\n" {
+		t.Errorf("incorrect RMI index %q", data)
+	}
+	checkRMILookups(t, inc, IndexLayout)
+	// Saving and removing messages updates the index.
+	saveRMIMessage(t, inc, "XND-003P", "AAA-007P")
+	if _, err := store.Stat("AAA-007P.txt"); err == nil {
+		t.Error("link created in index layout")
+	}
+	if got := inc.LMIForRMI("AAA-007P"); got != "XND-003P" {
+		t.Errorf("LMIForRMI(AAA-007P) after save = %q", got)
+	}
+	inc.RemoveMessage("XND-003P")
+	if got := inc.LMIForRMI("AAA-007P"); got != "" {
+		t.Errorf("LMIForRMI(AAA-007P) after remove = %q", got)
+	}
+	// Convert back to the symlink layout.
+	if err := inc.ConvertLayout(SymlinkLayout); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Stat(rmiIndexFile); err == nil {
+		t.Error("RMI index not removed by conversion to symlink layout")
+	}
+	for name, target := range map[string]string{
+		"AAA-005P.txt": "XND-001P.txt", "AAA-005P.pdf": "XND-001P.pdf",
+		"AAA-006P.txt": "XND-002P.txt", "AAA-006P.pdf": "XND-002P.pdf",
+	} {
+		if entry, err := store.Stat(name); err != nil || entry.Link != target {
+			t.Errorf("after conversion to symlink layout, %s = %+v, %v", name, entry, err)
+		}
+	}
+	checkRMILookups(t, inc, SymlinkLayout)
+	// Saving a message creates a link again.
+	saveRMIMessage(t, inc, "XND-003P", "AAA-007P")
+	if entry, err := store.Stat("AAA-007P.txt"); err != nil || entry.Link != "XND-003P.txt" {
+		t.Errorf("after save in symlink layout, AAA-007P.txt = %+v, %v", entry, err)
+	}
+}
+
+func TestRMILayoutMemory(t *testing.T) { testRMILayout(t, NewMemoryStore()) }
+func TestRMILayoutFS(t *testing.T)     { testRMILayout(t, NewFSStore(t.TempDir())) }
@@ -0,0 +1,344 @@
+package incident
+
+// This file contains the incident search index.
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+)
+
+// searchIndexFile is the name of the file containing the search index.
+const searchIndexFile = "search-index.json"
+
+// A SearchQuery describes the messages sought by Search.  A message must match
+// all of the criteria that are specified; empty criteria match everything.
+// All string comparisons are case-insensitive.
+type SearchQuery struct {
+	// Type is the message type tag (e.g. "ICS213" or "plain").
+	Type string
+	// From and To are substrings of the From and To (or Cc or Bcc) header
+	// of the message.
+	From string
+	To   string
+	// After and Before limit the date of the message:  the date it was
+	// received, for received messages, or sent, for outgoing ones.  After
+	// is inclusive; Before is exclusive.
+	After  time.Time
+	Before time.Time
+	// Handling is the handling order of the message (e.g. "IMMEDIATE").
+	Handling string
+	// Fields maps field labels or PIFO tags to substrings of the values of
+	// those fields.
+	Fields map[string]string
+	// Text is free text.  Each of its words must appear somewhere in the
+	// headers or field values of the message.
+	Text string
+	// Receipts, if true, causes receipts to be searched as well as
+	// messages.
+	Receipts bool
+}
+
+// A SearchResult identifies a message found by Search.
+type SearchResult struct {
+	// LMI is the local message ID of the message, or of the message to
+	// which the receipt applies.
+	LMI string
+	// Receipt is empty for a message.  For a receipt, it identifies the
+	// receipt as needed by ReadReceipt (e.g. "DR" or "RR2").
+	Receipt string
+}
+
+// searchDoc is the search index entry for a single message or receipt.
+type searchDoc struct {
+	ModTime  time.Time         `json:"modtime"`
+	Tag      string            `json:"tag"`
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Subject  string            `json:"subject"`
+	Date     time.Time         `json:"date"`
+	Handling string            `json:"handling,omitempty"`
+	Fields   map[string]string `json:"fields,omitempty"`
+}
+
+// searchIndex maps file name to search index entry.
+type searchIndex map[string]*searchDoc
+
+// Search returns the messages (and optionally receipts) matching the query, in
+// chronological order.  It uses the search index, which is kept up to date by
+// SaveMessage and SaveReceipt; any message files changed by other means are
+// re-indexed first.  An error is returned only if the incident or its index
+// cannot be read or written.
+func (inc *Incident) Search(q *SearchQuery) (results []SearchResult, err error) {
+	var (
+		index  searchIndex
+		names  []string
+		words  = strings.Fields(strings.ToLower(q.Text))
+		unlock func()
+	)
+	if inc, unlock, err = inc.lock(); err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if index, err = inc.freshSearchIndex(); err != nil {
+		return nil, err
+	}
+	for name, doc := range index {
+		if receiptExtRE.MatchString(name) && !q.Receipts {
+			continue
+		}
+		if doc.matches(q, words) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		di, dj := index[names[i]], index[names[j]]
+		if !di.Date.Equal(dj.Date) {
+			return di.Date.Before(dj.Date)
+		}
+		return names[i] < names[j]
+	})
+	for _, name := range names {
+		var result SearchResult
+
+		if idxs := receiptExtRE.FindStringIndex(name); idxs != nil {
+			result.LMI, result.Receipt = name[:idxs[0]], name[idxs[0]+1:len(name)-4]
+		} else {
+			result.LMI = name[:len(name)-4]
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// matches returns whether the search index entry matches the query.  words is
+// the lowercased free text of the query, split into words.
+func (doc *searchDoc) matches(q *SearchQuery, words []string) bool {
+	if q.Type != "" && !strings.EqualFold(q.Type, doc.Tag) {
+		return false
+	}
+	if q.From != "" && !containsFold(doc.From, q.From) {
+		return false
+	}
+	if q.To != "" && !containsFold(doc.To, q.To) {
+		return false
+	}
+	if !q.After.IsZero() && doc.Date.Before(q.After) {
+		return false
+	}
+	if !q.Before.IsZero() && !doc.Date.Before(q.Before) {
+		return false
+	}
+	if q.Handling != "" && !strings.EqualFold(q.Handling, doc.Handling) {
+		return false
+	}
+	for key, value := range q.Fields {
+		if !containsFold(doc.field(key), value) {
+			return false
+		}
+	}
+	if len(words) != 0 {
+		var sb strings.Builder
+		sb.WriteString(doc.From)
+		sb.WriteByte('\n')
+		sb.WriteString(doc.To)
+		sb.WriteByte('\n')
+		sb.WriteString(doc.Subject)
+		for _, value := range doc.Fields {
+			sb.WriteByte('\n')
+			sb.WriteString(value)
+		}
+		text := strings.ToLower(sb.String())
+		for _, word := range words {
+			if !strings.Contains(text, word) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// field returns the value of the field with the specified label or PIFO tag,
+// or "" if there is none.
+func (doc *searchDoc) field(key string) string {
+	if value, ok := doc.Fields[key]; ok {
+		return value
+	}
+	for k, value := range doc.Fields {
+		if strings.EqualFold(k, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+// containsFold returns whether substr is a substring of s, without regard to
+// case.
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// freshSearchIndex reads the search index, and brings it up to date with the
+// message and receipt files in the incident, based on their modification
+// times.  If anything changed, it writes the updated index.
+func (inc *Incident) freshSearchIndex() (index searchIndex, err error) {
+	var (
+		entries []StoreEntry
+		changed bool
+		seen    = make(map[string]bool)
+	)
+	if index, err = inc.readSearchIndex(); err != nil {
+		return nil, err
+	}
+	if entries, err = inc.store.List(); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !isMessageFile(entry) {
+			continue
+		}
+		seen[entry.Name] = true
+		if doc := index[entry.Name]; doc != nil && doc.ModTime.Equal(entry.ModTime) {
+			continue
+		}
+		if doc := inc.readSearchDoc(entry); doc != nil {
+			index[entry.Name] = doc
+		} else {
+			delete(index, entry.Name)
+		}
+		changed = true
+	}
+	for name := range index {
+		if !seen[name] {
+			delete(index, name)
+			changed = true
+		}
+	}
+	if changed {
+		err = inc.writeSearchIndex(index)
+	}
+	return index, err
+}
+
+// isMessageFile returns whether the store entry is a message or receipt file
+// (as opposed to a link or some other kind of file).
+func isMessageFile(entry StoreEntry) bool {
+	if entry.Link != "" || !strings.HasSuffix(entry.Name, ".txt") {
+		return false
+	}
+	if idxs := receiptExtRE.FindStringIndex(entry.Name); idxs != nil {
+		return MsgIDRE.MatchString(entry.Name[:idxs[0]])
+	}
+	return MsgIDRE.MatchString(entry.Name[:len(entry.Name)-4])
+}
+
+// readSearchDoc reads and decodes a message or receipt file and returns its
+// search index entry.  It returns nil if the file can't be read or parsed.
+func (inc *Incident) readSearchDoc(entry StoreEntry) *searchDoc {
+	var (
+		contents []byte
+		env      *envelope.Envelope
+		body     string
+		err      error
+	)
+	if contents, err = inc.store.ReadFile(entry.Name); err != nil {
+		return nil
+	}
+	if env, body, err = envelope.ParseSaved(string(contents)); err != nil {
+		return nil
+	}
+	return newSearchDoc(entry.ModTime, env, message.Decode(env, body))
+}
+
+// newSearchDoc returns the search index entry for a message.  It returns nil
+// if the message could not be decoded.
+func newSearchDoc(modtime time.Time, env *envelope.Envelope, msg message.Message) (doc *searchDoc) {
+	var mb *message.BaseMessage
+
+	if msg == nil {
+		return nil
+	}
+	mb = msg.Base()
+	doc = &searchDoc{
+		ModTime: modtime,
+		Tag:     mb.Type.Tag,
+		From:    env.From,
+		To:      env.Recipients(),
+		Subject: env.SubjectLine,
+		Date:    env.Date,
+		Fields:  make(map[string]string),
+	}
+	if env.IsReceived() {
+		doc.Date = env.ReceivedDate
+	}
+	if mb.FHandling != nil {
+		doc.Handling = *mb.FHandling
+	}
+	for _, f := range mb.Fields {
+		if f.Value == nil || *f.Value == "" {
+			continue
+		}
+		if f.Label != "" {
+			doc.Fields[f.Label] = *f.Value
+		}
+		if f.PIFOTag != "" {
+			doc.Fields[f.PIFOTag] = *f.Value
+		}
+	}
+	return doc
+}
+
+// readSearchIndex reads the search index.  A missing or corrupt index is
+// treated as empty; it will be rebuilt.
+func (inc *Incident) readSearchIndex() (index searchIndex, err error) {
+	var data []byte
+
+	if data, err = inc.store.ReadFile(searchIndexFile); errors.Is(err, fs.ErrNotExist) {
+		return make(searchIndex), nil
+	} else if err != nil {
+		return nil, err
+	}
+	if json.Unmarshal(data, &index) != nil || index == nil {
+		index = make(searchIndex)
+	}
+	return index, nil
+}
+
+// writeSearchIndex writes the search index.
+func (inc *Incident) writeSearchIndex(index searchIndex) (err error) {
+	var data []byte
+
+	if data, err = json.Marshal(index); err != nil {
+		return err
+	}
+	return inc.store.WriteFile(searchIndexFile, data)
+}
+
+// updateSearchIndex updates the search index entry for the named message or
+// receipt file, which was just written with the specified envelope and
+// message.  If env is nil, the entry is removed instead.  Errors are ignored,
+// since Search will repair the index anyway.
+func (inc *Incident) updateSearchIndex(filename string, env *envelope.Envelope, msg message.Message) {
+	index, err := inc.readSearchIndex()
+	if err != nil {
+		return
+	}
+	if env == nil {
+		delete(index, filename)
+	} else if entry, err := inc.store.Stat(filename); err == nil {
+		if doc := newSearchDoc(entry.ModTime, env, msg); doc != nil {
+			index[filename] = doc
+		} else {
+			delete(index, filename)
+		}
+	} else {
+		return
+	}
+	inc.writeSearchIndex(index)
+}
@@ -0,0 +1,130 @@
+package incident
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+	"github.com/rothskeller/packet/xscmsg/delivrcpt"
+	"github.com/rothskeller/packet/xscmsg/ics213"
+	"github.com/rothskeller/packet/xscmsg/plaintext"
+)
+
+func TestSearch(t *testing.T) {
+	var (
+		inc  = New(NewMemoryStore())
+		base = time.Date(2024, 1, 2, 15, 0, 0, 0, time.Local)
+	)
+	pt := plaintext.New().(*plaintext.PlainText)
+	pt.Subject, pt.Handling, pt.Body = "Road closure", "ROUTINE", "Highway 9 is closed at the summit."
+	env := &envelope.Envelope{From: "alice@w1xsc", To: "bob@w2xsc", Date: base}
+	env.SubjectLine = pt.EncodeSubject()
+	if err := inc.SaveMessage("XND-001P", "", env, pt, true, false); err != nil {
+		t.Fatal(err)
+	}
+	form := message.Create("ICS213", "").(*ics213.ICS213v22)
+	form.OriginMsgID, form.Handling = "XND-002P", "IMMEDIATE"
+	form.ToICSPosition, form.FromICSPosition = "Planning", "Logistics"
+	form.Subject, form.Message = "Shelter supplies", "Need 50 cots at the high school."
+	env = &envelope.Envelope{From: "carol@w3xsc", To: "alice@w1xsc", Date: base.Add(time.Hour)}
+	env.SubjectLine = form.EncodeSubject()
+	if err := inc.SaveMessage("XND-002P", "", env, form, true, false); err != nil {
+		t.Fatal(err)
+	}
+	denv := &envelope.Envelope{ReceivedBBS: "W2XSC", ReceivedDate: base.Add(2 * time.Hour), From: "bob@w2xsc", To: "alice@w1xsc", Date: base.Add(2 * time.Hour)}
+	dr := delivrcpt.New()
+	dr.LocalMessageID, dr.DeliveredTime, dr.MessageTo = "BBB-001P", "01/02/2024 17:00", "bob@w2xsc"
+	dr.MessageSubject = "XND-001P_R_Road closure"
+	denv.SubjectLine = dr.EncodeSubject()
+	if err := inc.SaveReceipt("XND-001P", denv, dr); err != nil {
+		t.Fatal(err)
+	}
+	msg1 := SearchResult{LMI: "XND-001P"}
+	msg2 := SearchResult{LMI: "XND-002P"}
+	rcpt := SearchResult{LMI: "XND-001P", Receipt: "DR"}
+	for _, tt := range []struct {
+		name string
+		q    SearchQuery
+		want []SearchResult
+	}{
+		{"all", SearchQuery{}, []SearchResult{msg1, msg2}},
+		{"receipts", SearchQuery{Receipts: true}, []SearchResult{msg1, msg2, rcpt}},
+		{"type", SearchQuery{Type: "ics213"}, []SearchResult{msg2}},
+		{"from", SearchQuery{From: "CAROL"}, []SearchResult{msg2}},
+		{"to", SearchQuery{To: "alice", Receipts: true}, []SearchResult{msg2, rcpt}},
+		{"after", SearchQuery{After: base.Add(time.Hour)}, []SearchResult{msg2}},
+		{"before", SearchQuery{Before: base.Add(time.Hour)}, []SearchResult{msg1}},
+		{"handling", SearchQuery{Handling: "immediate"}, []SearchResult{msg2}},
+		{"label", SearchQuery{Fields: map[string]string{"To ICS Position": "plan"}}, []SearchResult{msg2}},
+		{"pifo tag", SearchQuery{Fields: map[string]string{"12.": "cots"}}, []SearchResult{msg2}},
+		{"text", SearchQuery{Text: "highway summit"}, []SearchResult{msg1}},
+		{"text miss", SearchQuery{Text: "highway cots"}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := inc.Search(&tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// Removing a message removes it from the index.
+	inc.RemoveMessage("XND-002P")
+	if got, err := inc.Search(&SearchQuery{}); err != nil || !reflect.DeepEqual(got, []SearchResult{msg1}) {
+		t.Errorf("after remove: got %v, %v", got, err)
+	}
+}
+
+func TestSearchReindex(t *testing.T) {
+	var inc = New(NewMemoryStore())
+
+	pt := plaintext.New().(*plaintext.PlainText)
+	pt.Subject, pt.Handling, pt.Body = "Hello", "ROUTINE", "First version"
+	env := &envelope.Envelope{From: "alice@w1xsc", To: "bob@w2xsc", Date: time.Now()}
+	env.SubjectLine = pt.EncodeSubject()
+	if err := inc.SaveMessage("XND-001P", "", env, pt, true, false); err != nil {
+		t.Fatal(err)
+	}
+	// Rewrite the message behind the index's back, and lose the index.
+	pt.Body = "Second version"
+	time.Sleep(10 * time.Millisecond)
+	if err := inc.store.WriteFile("XND-001P.txt", []byte(env.RenderSaved(pt.EncodeBody()))); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := inc.Search(&SearchQuery{Text: "second"}); err != nil || len(got) != 1 {
+		t.Errorf("after rewrite: got %v, %v", got, err)
+	}
+	if err := inc.store.Remove(searchIndexFile); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := inc.Search(&SearchQuery{Text: "second"}); err != nil || len(got) != 1 {
+		t.Errorf("after index loss: got %v, %v", got, err)
+	}
+}
+
+func TestSearchUndecodable(t *testing.T) {
+	var inc = New(NewMemoryStore())
+
+	env := &envelope.Envelope{From: "alice@w1xsc", To: "bob@w2xsc", Cc: "carol@w3xsc", Date: time.Now()}
+	if doc := newSearchDoc(time.Now(), env, nil); doc != nil {
+		t.Errorf("newSearchDoc(nil) = %+v", doc)
+	}
+	pt := plaintext.New().(*plaintext.PlainText)
+	pt.Subject, pt.Handling, pt.Body = "Hello", "ROUTINE", "Hello"
+	env.SubjectLine = pt.EncodeSubject()
+	if err := inc.SaveMessage("XND-001P", "", env, pt, true, false); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := inc.Search(&SearchQuery{To: "carol"}); err != nil || len(got) != 1 {
+		t.Errorf("search by Cc: got %v, %v", got, err)
+	}
+	// An undecodable message drops out of the index rather than panicking.
+	inc.updateSearchIndex("XND-001P.txt", env, nil)
+	if index, err := inc.readSearchIndex(); err != nil || index["XND-001P.txt"] != nil {
+		t.Errorf("index entry after undecodable update: %v, %v", index["XND-001P.txt"], err)
+	}
+}
@@ -0,0 +1,286 @@
+package incident
+
+// This file contains the storage backends for incidents.
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Store is the storage backend for an incident.  It holds a flat set of named
+// files, some of which may be links (aliases) to other files.  All names are
+// simple file names without directory components.  Errors for nonexistent files
+// satisfy errors.Is(err, fs.ErrNotExist).
+type Store interface {
+	// ReadFile returns the contents of the named file, following a link
+	// if the name is one.
+	ReadFile(name string) ([]byte, error)
+	// WriteFile creates or replaces the named file with the supplied
+	// contents.
+	WriteFile(name string, data []byte) error
+	// Remove removes the named file or link.
+	Remove(name string) error
+	// Link creates a link with the specified name, referring to the
+	// target file.  It fails if a file or link with that name already
+	// exists.
+	Link(target, name string) error
+	// Stat returns information about the named file or link, without
+	// following links.
+	Stat(name string) (StoreEntry, error)
+	// List returns information about all of the files and links in the
+	// store, sorted by name.
+	List() ([]StoreEntry, error)
+	// Lock acquires an exclusive lock on the store, waiting until it is
+	// available, and returns a function that releases it.  The lock is not
+	// reentrant.  It serializes changes made through Incident methods;
+	// it is not required for the other Store methods, which are atomic
+	// individually.
+	Lock() (unlock func(), err error)
+}
+
+// A StoreEntry describes one file or link in a Store.
+type StoreEntry struct {
+	// Name is the name of the file or link.
+	Name string
+	// Link is the name of the file to which the entry refers, if the entry
+	// is a link.  It is empty for a regular file.
+	Link string
+	// ModTime is the time the file or link was last written.
+	ModTime time.Time
+}
+
+// FSStore is a Store that keeps the files in a directory of the file system.
+// Links are represented as symbolic links.  Files are written to a temporary
+// file and then renamed into place, so that readers never see a partially
+// written file.  The store lock is an advisory lock on the file .lock in the
+// directory; on platforms without advisory locking, it only excludes other
+// goroutines in the same process.
+type FSStore struct {
+	dir string
+}
+
+// NewFSStore returns a Store that keeps its files in the specified directory.
+func NewFSStore(dir string) *FSStore {
+	return &FSStore{dir: dir}
+}
+
+// Dir returns the directory in which the store keeps its files.
+func (s *FSStore) Dir() string { return s.dir }
+
+// Path returns the pathname of the named file in the store.
+func (s *FSStore) Path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// ReadFile implements Store.
+func (s *FSStore) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(s.Path(name))
+}
+
+// WriteFile implements Store.
+func (s *FSStore) WriteFile(name string, data []byte) (err error) {
+	// If the name is a link, write to its target (as os.WriteFile would),
+	// rather than replacing the link with a file.
+	if target, err := os.Readlink(s.Path(name)); err == nil {
+		name = target
+	}
+	return replaceFile(s.Path(name), data)
+}
+
+// replaceFile creates or replaces the named file with the supplied data.  It
+// writes a temporary file in the same directory and renames it into place, so
+// that readers never see a partially written file.  A new file is created with
+// mode 0666 less the umask, as os.WriteFile would; a replaced file keeps its
+// mode.
+func replaceFile(filename string, data []byte) (err error) {
+	var (
+		tmp   *os.File
+		tname string
+	)
+	for seq := 0; ; seq++ {
+		tname = filepath.Join(filepath.Dir(filename), fmt.Sprintf(".%s.%d.%d", filepath.Base(filename), os.Getpid(), seq))
+		if tmp, err = os.OpenFile(tname, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666); !errors.Is(err, fs.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		if info, err2 := os.Stat(filename); err2 == nil {
+			err = tmp.Chmod(info.Mode().Perm())
+		}
+	}
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err == nil {
+		err = os.Rename(tname, filename)
+	}
+	if err != nil {
+		os.Remove(tname)
+	}
+	return err
+}
+
+// Remove implements Store.
+func (s *FSStore) Remove(name string) error {
+	return os.Remove(s.Path(name))
+}
+
+// Link implements Store.
+func (s *FSStore) Link(target, name string) error {
+	return os.Symlink(target, s.Path(name))
+}
+
+// Stat implements Store.
+func (s *FSStore) Stat(name string) (entry StoreEntry, err error) {
+	var info os.FileInfo
+
+	if info, err = os.Lstat(s.Path(name)); err != nil {
+		return StoreEntry{}, err
+	}
+	return s.entry(info)
+}
+
+// entry converts a os.FileInfo into a StoreEntry.
+func (s *FSStore) entry(info os.FileInfo) (entry StoreEntry, err error) {
+	entry.Name, entry.ModTime = info.Name(), info.ModTime()
+	if info.Mode().Type() == os.ModeSymlink {
+		if entry.Link, err = os.Readlink(s.Path(entry.Name)); err != nil {
+			return StoreEntry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// Lock implements Store.
+func (s *FSStore) Lock() (unlock func(), err error) {
+	return lockFile(s.Path(".lock"))
+}
+
+// List implements Store.  Subdirectories and other special files are omitted.
+func (s *FSStore) List() (entries []StoreEntry, err error) {
+	var (
+		dir   *os.File
+		infos []os.FileInfo
+	)
+	if dir, err = os.Open(s.dir); err != nil {
+		return nil, err
+	}
+	defer dir.Close()
+	if infos, err = dir.Readdir(0); err != nil {
+		return nil, err
+	}
+	for _, info := range infos {
+		if t := info.Mode().Type(); t != 0 && t != os.ModeSymlink {
+			continue
+		}
+		if entry, err := s.entry(info); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// MemoryStore is a Store that keeps the files in memory.  It is safe for
+// concurrent use.
+type MemoryStore struct {
+	mutex sync.RWMutex
+	lock  sync.Mutex
+	files map[string]*memoryFile
+}
+type memoryFile struct {
+	data    []byte
+	link    string
+	modtime time.Time
+}
+
+// NewMemoryStore returns a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{files: make(map[string]*memoryFile)}
+}
+
+// ReadFile implements Store.
+func (s *MemoryStore) ReadFile(name string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	f := s.files[name]
+	if f != nil && f.link != "" {
+		f = s.files[f.link]
+	}
+	if f == nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+// WriteFile implements Store.
+func (s *MemoryStore) WriteFile(name string, data []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if f := s.files[name]; f != nil && f.link != "" {
+		name = f.link
+	}
+	s.files[name] = &memoryFile{data: append([]byte(nil), data...), modtime: time.Now()}
+	return nil
+}
+
+// Remove implements Store.
+func (s *MemoryStore) Remove(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.files[name] == nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(s.files, name)
+	return nil
+}
+
+// Link implements Store.
+func (s *MemoryStore) Link(target, name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.files[name] != nil {
+		return &fs.PathError{Op: "link", Path: name, Err: fs.ErrExist}
+	}
+	if target == "" {
+		return &fs.PathError{Op: "link", Path: name, Err: errors.New("empty link target")}
+	}
+	s.files[name] = &memoryFile{link: target, modtime: time.Now()}
+	return nil
+}
+
+// Stat implements Store.
+func (s *MemoryStore) Stat(name string) (StoreEntry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if f := s.files[name]; f != nil {
+		return StoreEntry{Name: name, Link: f.link, ModTime: f.modtime}, nil
+	}
+	return StoreEntry{}, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// List implements Store.
+func (s *MemoryStore) List() (entries []StoreEntry, err error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for name, f := range s.files {
+		entries = append(entries, StoreEntry{Name: name, Link: f.link, ModTime: f.modtime})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+// Lock implements Store.
+func (s *MemoryStore) Lock() (unlock func(), err error) {
+	s.lock.Lock()
+	return s.lock.Unlock, nil
+}
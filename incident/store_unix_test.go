@@ -0,0 +1,50 @@
+//go:build unix
+
+package incident
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestFSStoreWriteFileMode(t *testing.T) {
+	var (
+		dir   = t.TempDir()
+		store = NewFSStore(dir)
+	)
+	defer syscall.Umask(syscall.Umask(002))
+	mode := func(name string) fs.FileMode {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Mode().Perm()
+	}
+	// A new file gets 0666 less the umask.
+	if err := store.WriteFile("XND-001P.txt", []byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if got := mode("XND-001P.txt"); got != 0664 {
+		t.Errorf("new file mode = %o, want 664", got)
+	}
+	// A replaced file keeps its mode.
+	if err := os.Chmod(filepath.Join(dir, "XND-001P.txt"), 0660); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.WriteFile("XND-001P.txt", []byte("two")); err != nil {
+		t.Fatal(err)
+	}
+	if got := mode("XND-001P.txt"); got != 0660 {
+		t.Errorf("replaced file mode = %o, want 660", got)
+	}
+	// The allocator's counter file is shared the same way.
+	if _, err := NewAllocator(filepath.Join(dir, "msgnums")).Next("XND", 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := mode("msgnums"); got != 0664 {
+		t.Errorf("counter file mode = %o, want 664", got)
+	}
+}
@@ -0,0 +1,186 @@
+package incident
+
+// This file contains the message threading code.
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+)
+
+// msgIDInTextRE matches a message ID embedded in other text (e.g. in a
+// Reference field).  It must agree with MsgIDRE.
+var msgIDInTextRE = regexp.MustCompile(`\b(?:[0-9][A-Z]{2}|[A-Z][A-Z0-9]{2})-(?:[1-9][0-9]{2,}|0[1-9][0-9]|00[1-9])[A-Z]?\b`)
+
+// replyPrefixRE matches the reply and forward prefixes at the start of a
+// subject.
+var replyPrefixRE = regexp.MustCompile(`(?i)^(?:\s*(?:re|fwd?|fw)(?:\[\d+\])?\s*:)+\s*`)
+
+// A threadIndex groups the messages of an incident into threads.  It is a
+// union-find structure over LMIs.
+type threadIndex struct {
+	parent map[string]string
+	times  map[string]int // position in chronological order
+}
+
+// find returns the representative LMI of the thread containing lmi.
+func (ti *threadIndex) find(lmi string) string {
+	for ti.parent[lmi] != lmi {
+		ti.parent[lmi] = ti.parent[ti.parent[lmi]]
+		lmi = ti.parent[lmi]
+	}
+	return lmi
+}
+
+// join merges the threads containing a and b.
+func (ti *threadIndex) join(a, b string) {
+	if a, b = ti.find(a), ti.find(b); a != b {
+		ti.parent[b] = a
+	}
+}
+
+// threadIndex builds the thread index for the incident, linking messages as
+// described in Threads.
+func (inc *Incident) threadIndex() (ti *threadIndex, err error) {
+	var (
+		lmis     []string
+		ids      = make(map[string]string) // message ID => LMI
+		refs     = make(map[string]string) // LMI => Reference field
+		subjects = make(map[string]string) // normalized subject => latest LMI
+	)
+	if lmis, err = inc.AllLMIs(); err != nil {
+		return nil, err
+	}
+	ti = &threadIndex{parent: make(map[string]string), times: make(map[string]int)}
+	for i, lmi := range lmis {
+		ti.parent[lmi], ti.times[lmi] = lmi, i
+		ids[lmi] = lmi
+	}
+	for _, lmi := range lmis {
+		var (
+			env *envelope.Envelope
+			msg message.Message
+		)
+		if env, msg, err = inc.ReadMessage(lmi); err != nil {
+			continue
+		}
+		mb := msg.Base()
+		for _, id := range []*string{mb.FOriginMsgID, mb.FDestinationMsgID} {
+			if id != nil && MsgIDRE.MatchString(*id) && ids[*id] == "" {
+				ids[*id] = lmi
+			}
+		}
+		if !env.IsReceived() {
+			if delivs, err := inc.Deliveries(lmi); err == nil {
+				for _, deliv := range delivs {
+					if deliv.RemoteMessageID != "" && ids[deliv.RemoteMessageID] == "" {
+						ids[deliv.RemoteMessageID] = lmi
+					}
+				}
+			}
+		}
+		if mb.FReference != nil {
+			refs[lmi] = *mb.FReference
+		}
+		// Link replies by subject.  Since lmis is in chronological order,
+		// subjects[base] is the most recent earlier message with that
+		// subject.
+		var subject string
+		if mb.FSubject != nil {
+			subject = *mb.FSubject
+		} else {
+			_, _, _, _, subject = message.DecodeSubject(env.SubjectLine)
+		}
+		base := normalizeSubject(subject)
+		if base == "" {
+			continue
+		}
+		if replyPrefixRE.MatchString(subject) && subjects[base] != "" {
+			ti.join(subjects[base], lmi)
+		}
+		subjects[base] = lmi
+	}
+	// Link messages by Reference.  This is done after all messages are
+	// read, since a reference may be to a later message (e.g. if the
+	// clocks disagree).
+	for lmi, ref := range refs {
+		for _, id := range msgIDInTextRE.FindAllString(strings.ToUpper(ref), -1) {
+			target := ids[id]
+			if target == "" {
+				target = inc.LMIForRMI(id)
+			}
+			if target != "" && target != lmi {
+				ti.join(target, lmi)
+			}
+		}
+	}
+	return ti, nil
+}
+
+// normalizeSubject returns the subject without any reply or forward prefixes,
+// lowercased and with whitespace collapsed.
+func normalizeSubject(subject string) string {
+	subject = replyPrefixRE.ReplaceAllString(subject, "")
+	return strings.ToLower(strings.Join(strings.Fields(subject), " "))
+}
+
+// Thread returns the LMIs of the messages in the same thread (conversation) as
+// the message with the specified LMI, including that message, in
+// chronological order.  See Threads for how messages are grouped into
+// threads.  It returns an error if the incident cannot be read or there is no
+// message with the specified LMI.
+func (inc *Incident) Thread(lmi string) (lmis []string, err error) {
+	var ti *threadIndex
+
+	if ti, err = inc.threadIndex(); err != nil {
+		return nil, err
+	}
+	if _, ok := ti.parent[lmi]; !ok {
+		return nil, errors.New("no such message")
+	}
+	root := ti.find(lmi)
+	for m := range ti.parent {
+		if ti.find(m) == root {
+			lmis = append(lmis, m)
+		}
+	}
+	sort.Slice(lmis, func(i, j int) bool { return ti.times[lmis[i]] < ti.times[lmis[j]] })
+	return lmis, nil
+}
+
+// Threads returns all of the threads (conversations) in the incident.  Each
+// thread is a list of LMIs in chronological order, and the threads are sorted
+// by their first message.  Messages that are not part of any conversation are
+// returned as threads of one message.  Messages are linked into the same
+// thread when one message's Reference field names the other (by LMI, RMI, or
+// origin or destination message ID, including RMIs learned from delivery
+// receipts), or when one message's subject is a reply or forward ("Re:",
+// "Fwd:", etc.) of the other's.
+func (inc *Incident) Threads() (threads [][]string, err error) {
+	var (
+		ti    *threadIndex
+		lmis  []string
+		index = make(map[string]int)
+	)
+	if ti, err = inc.threadIndex(); err != nil {
+		return nil, err
+	}
+	for lmi := range ti.parent {
+		lmis = append(lmis, lmi)
+	}
+	sort.Slice(lmis, func(i, j int) bool { return ti.times[lmis[i]] < ti.times[lmis[j]] })
+	for _, lmi := range lmis {
+		root := ti.find(lmi)
+		if i, ok := index[root]; ok {
+			threads[i] = append(threads[i], lmi)
+		} else {
+			index[root] = len(threads)
+			threads = append(threads, []string{lmi})
+		}
+	}
+	return threads, nil
+}
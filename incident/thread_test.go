@@ -0,0 +1,56 @@
+package incident
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+	_ "github.com/rothskeller/packet/xscmsg/ics213"
+)
+
+func TestThreads(t *testing.T) {
+	var (
+		inc   = New(NewMemoryStore())
+		start = time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	)
+	for i, tt := range []struct {
+		lmi, rmi  string
+		tag       string
+		subject   string
+		reference string
+		received  bool
+	}{
+		{"XND-001P", "AAA-010P", "plain", "Supplies needed", "", false},
+		{"XND-002P", "", "plain", "RE: Supplies  needed", "", true},
+		{"XND-003P", "", "ICS213", "Other", "AAA-010P", true},
+		{"XND-004P", "", "plain", "Unrelated", "", false},
+		{"XND-005P", "", "plain", "Supplies needed", "", false},
+	} {
+		env := &envelope.Envelope{From: "a@b", To: "c@d", Date: start.Add(time.Duration(i) * time.Minute)}
+		if tt.received {
+			env.ReceivedBBS, env.ReceivedDate = "W1XSC", env.Date
+		}
+		msg := message.Create(tt.tag, "")
+		mb := msg.Base()
+		*mb.FSubject = tt.subject
+		if mb.FReference != nil {
+			*mb.FReference = tt.reference
+		}
+		if err := inc.SaveMessage(tt.lmi, tt.rmi, env, msg, true, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	threads, err := inc.Threads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{{"XND-001P", "XND-002P", "XND-003P"}, {"XND-004P"}, {"XND-005P"}}
+	if !reflect.DeepEqual(threads, expected) {
+		t.Errorf("Threads = %v; expected %v", threads, expected)
+	}
+	if thread, err := inc.Thread("XND-003P"); err != nil || !reflect.DeepEqual(thread, expected[0]) {
+		t.Errorf("Thread(XND-003P) = %v, %v; expected %v", thread, err, expected[0])
+	}
+}
@@ -97,30 +97,64 @@ func (c *Conn) IdentEvery(interval time.Duration, ident string) {
 }
 
 // Send sends a private message.  Note that the "to" addresses must be bare
-// addresses without any display name or angle brackets.
+// addresses without any display name or angle brackets.  The first address is
+// the primary recipient; any others are sent as carbon copies.
 func (c *Conn) Send(subject, body string, to ...string) (err error) {
+	if len(to) == 0 {
+		panic("jnos.Send with no destination address")
+	}
+	return c.SendCc(subject, body, to[:1], to[1:], nil)
+}
+
+// SendCc sends a private message with distinct primary (to), carbon-copy (cc),
+// and blind carbon-copy (bcc) recipients.  Note that all addresses must be
+// bare addresses without any display name or angle brackets.  JNOS accepts
+// only one primary recipient on its command line, so any additional primary
+// recipients are sent as carbon copies.  Blind carbon copies are sent as
+// separate messages, one to each bcc recipient, so that they do not appear in
+// the headers of the message seen by the other recipients.
+func (c *Conn) SendCc(subject, body string, to, cc, bcc []string) (err error) {
 	var cmd string
 
 	defer c.maybeIdent()
-	switch len(to) {
-	case 0:
-		panic("jnos.Send with no destination address")
-	case 1:
+	if len(to) == 0 {
+		panic("jnos.SendCc with no primary destination address")
+	}
+	cc = append(append([]string{}, to[1:]...), cc...)
+	if len(cc) == 0 {
 		cmd = "SP"
-	default:
+	} else {
 		cmd = "SC"
 	}
 	if err = c.t.Send(fmt.Sprintf("%s %s\n", cmd, to[0])); err != nil {
 		return err
 	}
-	if len(to) > 1 {
+	if len(cc) != 0 {
 		if _, err = c.t.ReadUntil("Cc: "); err != nil {
 			return err
 		}
-		if err = c.t.Send(strings.Join(to[1:], " ") + "\n"); err != nil {
+		if err = c.t.Send(strings.Join(cc, " ") + "\n"); err != nil {
 			return err
 		}
 	}
+	if err = c.sendSubjectAndBody(subject, body); err != nil {
+		return err
+	}
+	for _, addr := range bcc {
+		if err = c.t.Send(fmt.Sprintf("SP %s\n", addr)); err != nil {
+			return err
+		}
+		if err = c.sendSubjectAndBody(subject, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendSubjectAndBody handles the part of a send command that follows the
+// addresses:  it sends the subject and body, and waits for the message to be
+// queued.
+func (c *Conn) sendSubjectAndBody(subject, body string) (err error) {
 	if _, err = c.t.ReadUntil("Subject:\n"); err != nil {
 		return err
 	}
@@ -141,10 +175,7 @@ func (c *Conn) Send(subject, body string, to ...string) (err error) {
 	if _, err = c.t.ReadUntil("Msg queued\n"); err != nil {
 		return err
 	}
-	if err = c.skipLinesUntilPrompt(); err != nil {
-		return err
-	}
-	return nil
+	return c.skipLinesUntilPrompt()
 }
 
 // SendBulletin sends a bulletin message.  Note that the "to" address must be
@@ -154,30 +185,7 @@ func (c *Conn) SendBulletin(subject, body string, to string) (err error) {
 	if err = c.t.Send(fmt.Sprintf("SB %s\n", to)); err != nil {
 		return err
 	}
-	if _, err = c.t.ReadUntil("Subject:\n"); err != nil {
-		return err
-	}
-	if err = c.t.Send(subject + "\n"); err != nil {
-		return err
-	}
-	if _, err = c.t.ReadUntil("Enter message.  End with /EX or ^Z in first column (^A aborts):\n"); err != nil {
-		return err
-	}
-	if !strings.HasSuffix(body, "\n") {
-		body += "\n/EX\n"
-	} else {
-		body += "/EX\n"
-	}
-	if err = c.t.Send(body); err != nil {
-		return err
-	}
-	if _, err = c.t.ReadUntil("Msg queued\n"); err != nil {
-		return err
-	}
-	if err = c.skipLinesUntilPrompt(); err != nil {
-		return err
-	}
-	return nil
+	return c.sendSubjectAndBody(subject, body)
 }
 
 // SetArea switches to the specified message area.
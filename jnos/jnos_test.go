@@ -0,0 +1,40 @@
+package jnos_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rothskeller/packet/jnos/simulator"
+	"github.com/rothskeller/packet/jnos/telnet"
+)
+
+func TestSendCc(t *testing.T) {
+	sim, err := simulator.Start(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sim.Stop()
+	conn, err := telnet.Connect(simulator.ListenAddress, "xnd", "pw", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.SendCc("Hello", "line 1\nline 2", []string{"a@w1xsc", "b@w2xsc"}, []string{"c@w3xsc", "d@w4xsc"}, []string{"e@w5xsc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Send("Solo", "only\n", "f@w6xsc"); err != nil {
+		t.Fatal(err)
+	}
+	if err = conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The extra primary recipient goes on the Cc line with the others; the
+	// blind carbon copy is a separate message.
+	want := []string{
+		"SC a@w1xsc\nCc: b@w2xsc c@w3xsc d@w4xsc\nSubject: Hello\nline 1\nline 2\n",
+		"SP e@w5xsc\nSubject: Hello\nline 1\nline 2\n",
+		"SP f@w6xsc\nSubject: Solo\nonly\n",
+	}
+	if got := sim.Sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sent %q\nwant %q", got, want)
+	}
+}
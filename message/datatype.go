@@ -38,18 +38,12 @@ var (
 func NewAddressListField(f *Field) *Field {
 	if f.EditApply == nil {
 		f.EditApply = func(f *Field, s string) {
-			if addrs, err := envelope.ParseAddressList(s); err == nil {
-				// Normalize the syntax of each address by
-				// calling String() on it.  This quotes or
-				// unquotes things, adds or removes angle
-				// brackets, etc.
-				strs := make([]string, len(addrs))
-				for i, a := range addrs {
-					strs[i] = a.String()
-				}
-				// Join the list, which normalizes the
-				// separation between addresses.
-				s = strings.Join(strs, ", ")
+			// Normalize the syntax of each address.  This
+			// quotes or unquotes things, adds or removes angle
+			// brackets, normalizes the separation between
+			// addresses, etc.
+			if formatted, err := envelope.FormatAddressList(s, ", "); err == nil {
+				s = formatted
 			}
 			*f.Value = s
 		}
@@ -60,7 +54,7 @@ func NewAddressListField(f *Field) *Field {
 				return p
 			}
 			if _, err := envelope.ParseAddressList(*f.Value); err != nil {
-				return fmt.Sprintf("The %q field does not contain a valid address list.", f.Label)
+				return fmt.Sprintf("The %q field does not contain a valid address list: %s.", f.Label, err)
 			}
 			return ""
 		}
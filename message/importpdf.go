@@ -0,0 +1,388 @@
+package message
+
+// This file contains ImportPDF, which is the reverse of RenderPDF:  it reads
+// the values of the fillable form fields in a PDF and maps them onto the Fields
+// of a message, by matching the rectangles of the PDF form fields against the
+// coordinates of the fields' PDFRenderers.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/rothskeller/pdf/pdfstruct"
+)
+
+// ErrNoPDFForm is the error returned by ImportPDF if the PDF does not contain
+// any fillable form fields.
+var ErrNoPDFForm = errors.New("PDF does not contain a fillable form")
+
+// ErrPDFTypeUnknown is the error returned by ImportPDF if no registered message
+// type could be matched against the fields of the PDF form.
+var ErrPDFTypeUnknown = errors.New("PDF form does not match any known message type")
+
+// ImportPDF reads a filled-in PDF form and returns a message containing the
+// values of its fields.  tag and version identify the message type to create;
+// if tag is empty, every registered type that supports creation is tried, and
+// the one whose PDF layout matches the most form fields is used.  If version is
+// empty, the first registered version of the type is used.
+//
+// Form fields are mapped onto message fields by matching their rectangles
+// against the coordinates of the message fields' PDFRenderers, so this works
+// only for PDFs whose layout matches the one used by RenderPDF for the type.
+// Message fields that have no corresponding form field retain the default
+// values given to new messages of the type.  If some non-empty form fields
+// could not be matched to message fields, the message is returned along with a
+// Warning listing them.
+func ImportPDF(r pdfstruct.Reader, tag, version string) (msg Message, err error) {
+	var (
+		pdf     *pdfstruct.PDF
+		widgets []*pdfWidget
+		best    int
+		used    map[*pdfWidget]bool
+	)
+	if pdf, err = pdfstruct.Open(r); err != nil {
+		return nil, err
+	}
+	if widgets, err = readPDFWidgets(pdf); err != nil {
+		return nil, err
+	}
+	if len(widgets) == 0 {
+		return nil, ErrNoPDFForm
+	}
+	if tag != "" {
+		if msg = Create(tag, version); msg == nil {
+			return nil, fmt.Errorf("no such message type %s %s", tag, version)
+		}
+		_, used = importPDFFields(msg, widgets)
+	} else {
+		var tags = make([]string, 0, len(RegisteredTypes))
+		for tag := range RegisteredTypes {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			for _, mtype := range RegisteredTypes[tag] {
+				if mtype.create == nil {
+					continue
+				}
+				cand := mtype.create()
+				if score, cused := importPDFFields(cand, widgets); score > best {
+					msg, used, best = cand, cused, score
+				}
+			}
+		}
+		if msg == nil {
+			return nil, ErrPDFTypeUnknown
+		}
+	}
+	var unused []string
+	for _, w := range widgets {
+		if !used[w] && w.value != "" && w.value != "Off" {
+			unused = append(unused, w.name)
+		}
+	}
+	if len(unused) != 0 {
+		return msg, Warning{fmt.Errorf("PDF form fields not imported: %s", strings.Join(unused, ", "))}
+	}
+	return msg, nil
+}
+
+// importPDFFields copies the values of the PDF form widgets into the fields of
+// the message.  It returns the number of message fields that matched a widget,
+// and the set of widgets that were matched.
+func importPDFFields(msg Message, widgets []*pdfWidget) (score int, used map[*pdfWidget]bool) {
+	used = make(map[*pdfWidget]bool)
+	for _, f := range msg.Base().Fields {
+		r := msg.Base().Type.FieldPDFRenderer(f)
+		if f.Value == nil || r == nil {
+			continue
+		}
+		if importPDFField(f, r, widgets, used) {
+			score++
+		}
+	}
+	return score, used
+}
+
+// importPDFField looks for PDF form widgets matching the supplied renderer for
+// the supplied field.  If any are found, it sets the field value from them and
+// returns true.
+func importPDFField(f *Field, r PDFRenderer, widgets []*pdfWidget, used map[*pdfWidget]bool) (found bool) {
+	switch r := r.(type) {
+	case PDFMultiRenderer:
+		for _, sub := range r {
+			if importPDFField(f, sub, widgets, used) {
+				found = true
+			}
+		}
+	case *PDFTextRenderer:
+		var w, h = r.W, r.H
+		if w == 0 {
+			w = r.R - r.X
+		}
+		if h == 0 {
+			h = r.B - r.Y
+		}
+		if wid := bestTextWidget(widgets, used, max(r.Page, 1), r.X, r.Y, w, h); wid != nil {
+			used[wid], found = true, true
+			if wid.value != "" {
+				f.EditApply(f, wid.value)
+			}
+		}
+	case *PDFMappedTextRenderer:
+		var h = r.H
+		if h == 0 {
+			h = r.B - r.Y
+		}
+		if wid := pointWidget(widgets, false, max(r.Page, 1), r.X+5, r.Y+h/2); wid != nil && !used[wid] {
+			used[wid], found = true, true
+			// Values that were rendered through the map are mapped
+			// back; anything else is applied as if typed in.
+			var value = strings.TrimSpace(wid.value)
+			for key, mapped := range r.Map {
+				if mapped != "" && strings.EqualFold(mapped, value) {
+					value = key
+					break
+				}
+			}
+			if value != "" {
+				f.EditApply(f, value)
+			}
+		}
+	case *PDFRadioRenderer:
+		for key, pt := range r.Points {
+			if wid := pointWidget(widgets, true, max(r.Page, 1), pt[0], pt[1]); wid != nil {
+				used[wid], found = true, true
+				if wid.on {
+					f.EditApply(f, key)
+				}
+			}
+		}
+	case *PDFCheckRenderer:
+		for key, pt := range r.Points {
+			if wid := pointWidget(widgets, true, max(r.Page, 1), pt[0]+r.W/2, pt[1]+r.H/2); wid != nil {
+				used[wid], found = true, true
+				if wid.on {
+					f.EditApply(f, key)
+				}
+			}
+		}
+	}
+	return found
+}
+
+// bestTextWidget returns the unused text widget on the specified page that best
+// overlaps the specified box, or nil if none overlaps it substantially.
+func bestTextWidget(widgets []*pdfWidget, used map[*pdfWidget]bool, page int, x, y, w, h float64) (best *pdfWidget) {
+	var bestOverlap = 0.5
+	for _, wid := range widgets {
+		if wid.page != page || wid.button || used[wid] {
+			continue
+		}
+		ix := math.Min(x+w, wid.x+wid.w) - math.Max(x, wid.x)
+		iy := math.Min(y+h, wid.y+wid.h) - math.Max(y, wid.y)
+		if ix <= 0 || iy <= 0 {
+			continue
+		}
+		// The overlap is measured as intersection over union, so that
+		// a large form field doesn't match all of the small boxes
+		// inside it.
+		overlap := ix * iy / (w*h + wid.w*wid.h - ix*iy)
+		if overlap > bestOverlap {
+			best, bestOverlap = wid, overlap
+		}
+	}
+	return best
+}
+
+// pointWidget returns the widget on the specified page that contains the
+// specified point (with a little tolerance), or nil if there is none.  button
+// indicates whether a button or a text widget is wanted.
+func pointWidget(widgets []*pdfWidget, button bool, page int, x, y float64) *pdfWidget {
+	const slop = 2
+	for _, wid := range widgets {
+		if wid.page != page || wid.button != button {
+			continue
+		}
+		if x >= wid.x-slop && x <= wid.x+wid.w+slop && y >= wid.y-slop && y <= wid.y+wid.h+slop {
+			return wid
+		}
+	}
+	return nil
+}
+
+// A pdfWidget describes a single widget (i.e., on-page appearance) of a PDF
+// form field.
+type pdfWidget struct {
+	// name is the fully qualified name of the form field.
+	name string
+	// page is the page number on which the widget appears.
+	page int
+	// x, y, w, and h are the widget rectangle, in the same coordinate
+	// system used by PDFRenderers (i.e., origin at top left).
+	x, y, w, h float64
+	// button is true if the widget is a checkbox or radio button.
+	button bool
+	// on is true if the widget is a button and it is selected.
+	on bool
+	// value is the value of the form field.
+	value string
+}
+
+// readPDFWidgets returns the list of all form field widgets in the PDF.
+func readPDFWidgets(pdf *pdfstruct.PDF) (widgets []*pdfWidget, err error) {
+	var (
+		form    pdfstruct.Dict
+		fields  pdfstruct.Array
+		pages   = make(map[pdfstruct.Reference]int)
+		heights []float64
+	)
+	if form, _ = pdfResolve(pdf, pdf.Catalog["AcroForm"]).(pdfstruct.Dict); form == nil {
+		return nil, nil
+	}
+	if fields, _ = pdfResolve(pdf, form["Fields"]).(pdfstruct.Array); fields == nil {
+		return nil, nil
+	}
+	if ref, ok := pdf.Catalog["Pages"].(pdfstruct.Reference); ok {
+		heights = readPDFPages(pdf, ref, 792, pages, heights)
+	}
+	if len(heights) == 0 {
+		return nil, errors.New("PDF has no pages")
+	}
+	for _, f := range fields {
+		widgets = readPDFWidget(pdf, f, "", "", nil, pages, heights, widgets)
+	}
+	return widgets, nil
+}
+
+// readPDFPages walks the page tree of the PDF, recording the page number of
+// each page object in pages and the height of each page in heights.
+func readPDFPages(
+	pdf *pdfstruct.PDF, ref pdfstruct.Reference, height float64, pages map[pdfstruct.Reference]int, heights []float64,
+) []float64 {
+	var node, _ = pdfResolve(pdf, ref).(pdfstruct.Dict)
+	if node == nil {
+		return heights
+	}
+	if mb, _ := pdfResolve(pdf, node["MediaBox"]).(pdfstruct.Array); len(mb) == 4 {
+		height = pdfNumber(pdf, mb[3]) - pdfNumber(pdf, mb[1])
+	}
+	if node["Type"] == pdfstruct.Name("Page") {
+		pages[ref] = len(heights) + 1
+		return append(heights, height)
+	}
+	kids, _ := pdfResolve(pdf, node["Kids"]).(pdfstruct.Array)
+	for _, kid := range kids {
+		if kref, ok := kid.(pdfstruct.Reference); ok {
+			heights = readPDFPages(pdf, kref, height, pages, heights)
+		}
+	}
+	return heights
+}
+
+// readPDFWidget adds to the widget list the widgets of the supplied form field
+// and its descendants.  name, ftype, and value are those inherited from the
+// parent field.
+func readPDFWidget(
+	pdf *pdfstruct.PDF, obj pdfstruct.Object, name string, ftype pdfstruct.Name, value pdfstruct.Object,
+	pages map[pdfstruct.Reference]int, heights []float64, widgets []*pdfWidget,
+) []*pdfWidget {
+	var field, _ = pdfResolve(pdf, obj).(pdfstruct.Dict)
+	if field == nil {
+		return widgets
+	}
+	if t, ok := pdfResolve(pdf, field["T"]).(string); ok && t != "" {
+		if name != "" {
+			name += "."
+		}
+		name += decodePDFString(t)
+	}
+	if ft, ok := field["FT"].(pdfstruct.Name); ok {
+		ftype = ft
+	}
+	if v := pdfResolve(pdf, field["V"]); v != nil {
+		value = v
+	}
+	if kids, _ := pdfResolve(pdf, field["Kids"]).(pdfstruct.Array); len(kids) != 0 {
+		for _, kid := range kids {
+			widgets = readPDFWidget(pdf, kid, name, ftype, value, pages, heights, widgets)
+		}
+		return widgets
+	}
+	rect, _ := pdfResolve(pdf, field["Rect"]).(pdfstruct.Array)
+	if len(rect) != 4 {
+		return widgets
+	}
+	var wid = pdfWidget{name: name, page: 1, button: ftype == "Btn"}
+	if pref, ok := field["P"].(pdfstruct.Reference); ok && pages[pref] != 0 {
+		wid.page = pages[pref]
+	}
+	llx, lly := pdfNumber(pdf, rect[0]), pdfNumber(pdf, rect[1])
+	urx, ury := pdfNumber(pdf, rect[2]), pdfNumber(pdf, rect[3])
+	wid.x, wid.w = math.Min(llx, urx), math.Abs(urx-llx)
+	wid.y, wid.h = heights[wid.page-1]-math.Max(lly, ury), math.Abs(ury-lly)
+	switch v := value.(type) {
+	case string:
+		wid.value = decodePDFString(v)
+	case pdfstruct.Name:
+		wid.value = string(v)
+	}
+	if wid.button {
+		// The state of an individual button is given by its appearance
+		// state (AS).  Some PDF writers don't set it, in which case
+		// we fall back to the field value.
+		if as, ok := field["AS"].(pdfstruct.Name); ok {
+			wid.on = as != "Off"
+		} else {
+			wid.on = wid.value != "" && wid.value != "Off"
+		}
+	} else {
+		wid.value = strings.ReplaceAll(strings.ReplaceAll(wid.value, "\r\n", "\n"), "\r", "\n")
+	}
+	return append(widgets, &wid)
+}
+
+// pdfResolve resolves an indirect reference, returning the referenced object.
+// Direct objects are returned unchanged.  Unresolvable references yield nil.
+func pdfResolve(pdf *pdfstruct.PDF, obj pdfstruct.Object) pdfstruct.Object {
+	if ref, ok := obj.(pdfstruct.Reference); ok {
+		var err error
+		if obj, err = pdf.Get(ref); err != nil {
+			return nil
+		}
+	}
+	return obj
+}
+
+// pdfNumber returns the value of a numeric PDF object, or zero if it isn't
+// numeric.
+func pdfNumber(pdf *pdfstruct.PDF, obj pdfstruct.Object) float64 {
+	switch n := pdfResolve(pdf, obj).(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// decodePDFString decodes a PDF text string, which is either UTF-16BE with a
+// byte order mark or (approximately) Latin-1.
+func decodePDFString(s string) string {
+	if len(s) >= 2 && s[0] == 0xFE && s[1] == 0xFF {
+		var u16 = make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			u16 = append(u16, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(u16))
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		sb.WriteRune(rune(s[i]))
+	}
+	return sb.String()
+}
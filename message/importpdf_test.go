@@ -0,0 +1,38 @@
+package message
+
+import "testing"
+
+func TestImportPDFField(t *testing.T) {
+	var (
+		value   string
+		choices = Choices{"Yes", "No", "Checked"}
+		widgets = []*pdfWidget{
+			{name: "mapped", page: 1, x: 100, y: 100, w: 100, h: 20, value: "Affirmative"},
+			{name: "typed", page: 1, x: 100, y: 200, w: 100, h: 20, value: " n "},
+			{name: "yes", page: 1, x: 300, y: 100, w: 10, h: 10, button: true, on: false},
+			{name: "no", page: 1, x: 400, y: 100, w: 10, h: 10, button: true, on: true},
+			{name: "check", page: 1, x: 300, y: 200, w: 10, h: 10, button: true, on: true},
+		}
+	)
+	for _, tt := range []struct {
+		name     string
+		renderer PDFRenderer
+		want     string
+	}{
+		{"mapped", &PDFMappedTextRenderer{X: 100, Y: 100, H: 20, Map: map[string]string{"Yes": "Affirmative", "No": "Negative"}}, "Yes"},
+		{"mapped unknown", &PDFMappedTextRenderer{X: 100, Y: 200, H: 20, Map: map[string]string{"Yes": "Affirmative"}}, "No"},
+		{"radio", &PDFRadioRenderer{Points: map[string][]float64{"Yes": {305, 105}, "No": {405, 105}}}, "No"},
+		{"check", &PDFCheckRenderer{W: 10, H: 10, Points: map[string][]float64{"checked": {300, 200}}}, "Checked"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			value = ""
+			f := NewRestrictedField(&Field{Label: "Test", Value: &value, Choices: choices})
+			if !importPDFField(f, tt.renderer, widgets, make(map[*pdfWidget]bool)) {
+				t.Fatal("no widget found")
+			}
+			if value != tt.want {
+				t.Errorf("value = %q, want %q", value, tt.want)
+			}
+		})
+	}
+}
@@ -34,7 +34,9 @@ type Message interface {
 	// filename, overwriting any existing file with that name.  This method
 	// will return ErrNotSupported for message types that do not support PDF
 	// rendering.  Note that the program needs to be built with "-tags
-	// packetpdf" in order for any message types to support PDF rendering.
+	// packetpdf", or PDF templates need to be registered with
+	// RegisterPDFBase, in order for any message types to support PDF
+	// rendering.
 	RenderPDF(env *envelope.Envelope, filename string) error
 	// SetOperator sets the operator only fields of the message, if it has
 	// them.
@@ -27,6 +27,9 @@ type Type struct {
 	Article string
 	// PDFBase is the PDF template (i.e., blank form) onto which we will
 	// render the field values to create a PDF rendering of the message.
+	// It is normally embedded when the program is built with "-tags
+	// packetpdf", and can be overridden with RegisterPDFBase.  Callers
+	// should use PDFTemplate rather than reading it directly.
 	PDFBase []byte
 	// create is the function to create a new outgoing message of this type, with
 	// appropriate default values for fields.  It is nil if new messages of this
@@ -0,0 +1,98 @@
+package message
+
+// This file contains the registry of PDF templates and renderers.  Message
+// types normally carry their PDF template in Type.PDFBase (embedded when the
+// program is built with "-tags packetpdf") and their renderers in the
+// Field.PDFRenderer of each field.  The registry allows either of those to be
+// supplied or overridden at run time, e.g., to use an updated county form
+// loaded from disk.
+
+import (
+	"os"
+	"sync"
+)
+
+// PDFRendererMap is a map from field label to the PDFRenderer for that field.
+type PDFRendererMap map[string]PDFRenderer
+
+type pdfRegistryKey struct{ tag, version string }
+
+var (
+	pdfRegistryLock sync.RWMutex
+	pdfBases        = make(map[pdfRegistryKey][]byte)
+	pdfRenderers    = make(map[pdfRegistryKey]PDFRendererMap)
+)
+
+// RegisterPDFBase registers a PDF template (i.e., blank form) for the message
+// type with the specified tag and version.  It overrides the template in the
+// Type.PDFBase, if any.  An empty version applies to all versions of the type
+// that do not have a template registered for their specific version.  A nil
+// base removes a previous registration.
+func RegisterPDFBase(tag, version string, base []byte) {
+	pdfRegistryLock.Lock()
+	defer pdfRegistryLock.Unlock()
+	if base == nil {
+		delete(pdfBases, pdfRegistryKey{tag, version})
+	} else {
+		pdfBases[pdfRegistryKey{tag, version}] = base
+	}
+}
+
+// LoadPDFBase reads a PDF template from the specified file and registers it
+// for the message type with the specified tag and version.
+func LoadPDFBase(tag, version, filename string) (err error) {
+	var base []byte
+
+	if base, err = os.ReadFile(filename); err != nil {
+		return err
+	}
+	RegisterPDFBase(tag, version, base)
+	return nil
+}
+
+// RegisterPDFRenderers registers PDF renderers for fields of the message type
+// with the specified tag and version.  The renderers override the
+// Field.PDFRenderer of the fields with the corresponding labels; fields whose
+// labels are not in the map are unaffected.  A nil renderer in the map
+// suppresses rendering of that field.  An empty version applies to all
+// versions of the type that do not have renderers registered for their
+// specific version.  A nil map removes a previous registration.
+func RegisterPDFRenderers(tag, version string, renderers PDFRendererMap) {
+	pdfRegistryLock.Lock()
+	defer pdfRegistryLock.Unlock()
+	if renderers == nil {
+		delete(pdfRenderers, pdfRegistryKey{tag, version})
+	} else {
+		pdfRenderers[pdfRegistryKey{tag, version}] = renderers
+	}
+}
+
+// PDFTemplate returns the PDF template for the message type:  the one
+// registered with RegisterPDFBase if any, otherwise the PDFBase of the type.
+// It returns nil if the message type does not support PDF rendering.
+func (mt *Type) PDFTemplate() []byte {
+	pdfRegistryLock.RLock()
+	defer pdfRegistryLock.RUnlock()
+	if base, ok := pdfBases[pdfRegistryKey{mt.Tag, mt.Version}]; ok {
+		return base
+	}
+	if base, ok := pdfBases[pdfRegistryKey{mt.Tag, ""}]; ok {
+		return base
+	}
+	return mt.PDFBase
+}
+
+// FieldPDFRenderer returns the PDF renderer for the specified field of a
+// message of this type:  the one registered with RegisterPDFRenderers if any,
+// otherwise the field's own PDFRenderer.  It may return nil.
+func (mt *Type) FieldPDFRenderer(f *Field) PDFRenderer {
+	pdfRegistryLock.RLock()
+	defer pdfRegistryLock.RUnlock()
+	if r, ok := pdfRenderers[pdfRegistryKey{mt.Tag, mt.Version}][f.Label]; ok {
+		return r
+	}
+	if r, ok := pdfRenderers[pdfRegistryKey{mt.Tag, ""}][f.Label]; ok {
+		return r
+	}
+	return f.PDFRenderer
+}
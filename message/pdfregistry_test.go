@@ -0,0 +1,45 @@
+package message
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPDFRegistry(t *testing.T) {
+	var (
+		builtin  = []byte("builtin")
+		override = []byte("override")
+		fieldr   = new(PDFTextRenderer)
+		overr    = new(PDFTextRenderer)
+		mt       = &Type{Tag: "TEST", Version: "1.0", PDFBase: builtin}
+		f        = &Field{Label: "Label", PDFRenderer: fieldr}
+		other    = &Field{Label: "Other", PDFRenderer: fieldr}
+	)
+	if got := mt.PDFTemplate(); !bytes.Equal(got, builtin) {
+		t.Errorf("unregistered: got %q", got)
+	}
+	RegisterPDFBase("TEST", "", override)
+	if got := mt.PDFTemplate(); !bytes.Equal(got, override) {
+		t.Errorf("registered for all versions: got %q", got)
+	}
+	RegisterPDFBase("TEST", "1.0", builtin)
+	if got := mt.PDFTemplate(); !bytes.Equal(got, builtin) {
+		t.Errorf("registered for version: got %q", got)
+	}
+	RegisterPDFBase("TEST", "1.0", nil)
+	RegisterPDFBase("TEST", "", nil)
+	if got := mt.PDFTemplate(); !bytes.Equal(got, builtin) {
+		t.Errorf("unregistered again: got %q", got)
+	}
+	RegisterPDFRenderers("TEST", "1.0", PDFRendererMap{"Label": overr})
+	if got := mt.FieldPDFRenderer(f); got != overr {
+		t.Errorf("overridden field: got %v", got)
+	}
+	if got := mt.FieldPDFRenderer(other); got != fieldr {
+		t.Errorf("other field: got %v", got)
+	}
+	RegisterPDFRenderers("TEST", "1.0", nil)
+	if got := mt.FieldPDFRenderer(f); got != fieldr {
+		t.Errorf("unregistered field: got %v", got)
+	}
+}
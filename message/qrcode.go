@@ -0,0 +1,201 @@
+package message
+
+// This file contains the QR code encoding of message bodies on rendered PDFs,
+// and the decoding of scanned QR code payloads back into messages.  A message
+// body is split into chunks, each of which is encoded into its own QR code, so
+// that long messages stay within the capacity of a reliably scannable code.
+// Each chunk payload has the form
+//
+//	PKTQR «n»/«count»
+//	«chunk»
+//
+// where «n» is the one-based chunk number.  The chunks can be scanned in any
+// order.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/boombuler/barcode/qr"
+	"github.com/rothskeller/gofpdf"
+
+	"github.com/rothskeller/packet/envelope"
+)
+
+// IncludeQRCodes is a global flag that can be set by callers.  When true, PDFs
+// generated by BaseMessage.RenderPDF have additional pages with QR codes
+// containing the complete encoded message body, so that the message can be
+// recovered from a paper copy without retyping it.
+var IncludeQRCodes = false
+
+// qrChunkSize is the maximum number of message body bytes in each QR code.  It
+// is well under the capacity of the largest QR code, so that the codes remain
+// scannable when printed.
+const qrChunkSize = 800
+
+// qrPayloadPrefix is the prefix of every QR code payload.
+const qrPayloadPrefix = "PKTQR "
+
+// ErrQRPayload is the error returned by DecodeQRPayloads when a payload is not
+// one generated by this package.
+var ErrQRPayload = errors.New("not a packet message QR code")
+
+// EncodeQRPayloads splits the supplied message body into chunks and returns
+// the QR code payloads for them.
+func EncodeQRPayloads(body string) (payloads []string) {
+	var chunks []string
+
+	for len(body) > qrChunkSize {
+		// Don't split a multibyte UTF-8 character across chunks.
+		size := qrChunkSize
+		for size > 0 && body[size]&0xC0 == 0x80 {
+			size--
+		}
+		chunks = append(chunks, body[:size])
+		body = body[size:]
+	}
+	chunks = append(chunks, body)
+	for i, chunk := range chunks {
+		payloads = append(payloads, fmt.Sprintf("%s%d/%d\n%s", qrPayloadPrefix, i+1, len(chunks), chunk))
+	}
+	return payloads
+}
+
+// DecodeQRPayloads reassembles the message body from the supplied QR code
+// payloads, which may be in any order, and decodes it into a message.  env is
+// the envelope to use for decoding; if it is nil, an empty one is used.  An
+// error is returned if any payload is malformed, or if any chunk is missing.
+func DecodeQRPayloads(env *envelope.Envelope, payloads []string) (msg Message, err error) {
+	var body string
+
+	if body, err = joinQRPayloads(payloads); err != nil {
+		return nil, err
+	}
+	if env == nil {
+		env = new(envelope.Envelope)
+	}
+	if msg = Decode(env, body); msg == nil {
+		return nil, errors.New("QR code contents could not be decoded as a message")
+	}
+	return msg, nil
+}
+
+// joinQRPayloads reassembles the message body from the supplied QR code
+// payloads.
+func joinQRPayloads(payloads []string) (body string, err error) {
+	var (
+		chunks []string
+		seen   []bool
+	)
+	for _, payload := range payloads {
+		var (
+			header string
+			chunk  string
+			num    int
+			count  int
+			found  bool
+		)
+		if header, chunk, found = strings.Cut(payload, "\n"); !found || !strings.HasPrefix(header, qrPayloadPrefix) {
+			return "", ErrQRPayload
+		}
+		nstr, cstr, _ := strings.Cut(header[len(qrPayloadPrefix):], "/")
+		if num, err = strconv.Atoi(nstr); err != nil {
+			return "", ErrQRPayload
+		}
+		if count, err = strconv.Atoi(cstr); err != nil || num < 1 || num > count {
+			return "", ErrQRPayload
+		}
+		if chunks == nil {
+			chunks, seen = make([]string, count), make([]bool, count)
+		} else if count != len(chunks) || (seen[num-1] && chunks[num-1] != chunk) {
+			return "", errors.New("QR codes are from different messages")
+		}
+		chunks[num-1], seen[num-1] = chunk, true
+	}
+	if chunks == nil {
+		return "", errors.New("no QR codes")
+	}
+	for i := range chunks {
+		if !seen[i] {
+			return "", fmt.Errorf("QR code %d of %d is missing", i+1, len(chunks))
+		}
+	}
+	return strings.Join(chunks, ""), nil
+}
+
+// renderQRCodes adds pages to the PDF with QR codes containing the supplied
+// message body.  The codes are laid out two across and three down on each
+// page.
+func renderQRCodes(pdf *gofpdf.Fpdf, body string) (err error) {
+	const (
+		size   = 230.0
+		margin = 36.0
+		gutter = (612 - 2*margin - 2*size)
+	)
+	var payloads = EncodeQRPayloads(body)
+
+	for i, payload := range payloads {
+		var code qrCode
+
+		if i%6 == 0 {
+			pdf.AddPageFormat("P", gofpdf.SizeType{Wd: 612, Ht: 792})
+			pdf.SetFont("Helvetica", "B", 12)
+			pdf.SetTextColor(0, 0, 0)
+			pdf.Text(margin, margin, "Machine-readable copy of this message.  Scan all codes, in any order.")
+		}
+		if code, err = encodeQRCode(payload); err != nil {
+			return err
+		}
+		x := margin + float64(i%2)*(size+gutter)
+		y := margin + 12 + float64(i%6/2)*(size+14)
+		code.draw(pdf, x, y, size)
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.Text(x, y+size+9, fmt.Sprintf("%d of %d", i+1, len(payloads)))
+	}
+	return nil
+}
+
+// qrCode is the module grid of an encoded QR code.
+type qrCode [][]bool
+
+// encodeQRCode encodes the supplied payload into a QR code.
+func encodeQRCode(payload string) (code qrCode, err error) {
+	bc, err := qr.Encode(payload, qr.M, qr.Unicode)
+	if err != nil {
+		return nil, err
+	}
+	bounds := bc.Bounds()
+	code = make(qrCode, bounds.Dy())
+	for y := range code {
+		code[y] = make([]bool, bounds.Dx())
+		for x := range code[y] {
+			r, _, _, _ := bc.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			code[y][x] = r == 0
+		}
+	}
+	return code, nil
+}
+
+// draw draws the QR code into a square of the specified size, including the
+// four-module quiet zone required around it.  Dark modules are drawn as
+// vector rectangles, so the code is crisp at any print resolution.
+func (code qrCode) draw(pdf *gofpdf.Fpdf, x, y, size float64) {
+	var module = size / float64(len(code)+8)
+
+	pdf.SetFillColor(0, 0, 0)
+	for row, modules := range code {
+		for col := 0; col < len(modules); col++ {
+			if !modules[col] {
+				continue
+			}
+			// Draw runs of dark modules as a single rectangle.
+			start := col
+			for col+1 < len(modules) && modules[col+1] {
+				col++
+			}
+			pdf.Rect(x+float64(start+4)*module, y+float64(row+4)*module, float64(col-start+1)*module, module, "F")
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package message
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQRPayloads(t *testing.T) {
+	body := strings.Repeat("Grüße aus Santa Clara County.\n", 100)
+	payloads := EncodeQRPayloads(body)
+	if len(payloads) < 2 {
+		t.Fatalf("expected multiple chunks, got %d", len(payloads))
+	}
+	for _, payload := range payloads {
+		if _, err := encodeQRCode(payload); err != nil {
+			t.Fatalf("encode QR code: %s", err)
+		}
+	}
+	// Reverse the payloads to make sure order doesn't matter.
+	reversed := make([]string, len(payloads))
+	for i, payload := range payloads {
+		reversed[len(payloads)-1-i] = payload
+	}
+	if got, err := joinQRPayloads(reversed); err != nil {
+		t.Errorf("join: %s", err)
+	} else if got != body {
+		t.Errorf("join: body mismatch")
+	}
+	if _, err := joinQRPayloads(payloads[1:]); err == nil || err.Error() != "QR code 1 of 4 is missing" {
+		t.Errorf("missing chunk: got error %v", err)
+	}
+	if _, err := joinQRPayloads([]string{"hello"}); err != ErrQRPayload {
+		t.Errorf("bad payload: got error %v", err)
+	}
+	if got, err := joinQRPayloads(EncodeQRPayloads("")); err != nil || got != "" {
+		t.Errorf("empty body: got %q, %v", got, err)
+	}
+}
@@ -34,7 +34,7 @@ func (w Warning) Error() string { return w.err.Error() }
 
 // ErrNotSupported is the error returned if RenderPDF is called on a message
 // with a type that does not support PDF rendering.
-var ErrNotSupported = errors.New("message type does not support PDF rendering, or program was not built with -tags packetpdf")
+var ErrNotSupported = errors.New("message type does not support PDF rendering, or no PDF template is available for it (program was not built with -tags packetpdf, and none was registered)")
 
 // RenderPDF renders the message as a PDF file with the specified filename,
 // overwriting any existing file with that name.  If the returned error is nil
@@ -47,15 +47,16 @@ func (bm *BaseMessage) RenderPDF(_ *envelope.Envelope, filename string) (err err
 		imp   *gofpdi.Importer
 		sizes map[int]map[string]map[string]float64
 		warn  Warning
+		base  = bm.Type.PDFTemplate()
 		page  = 1
 		nump  = 1
 	)
-	if bm.Type.PDFBase == nil {
+	if base == nil {
 		os.Remove(filename)
 		return ErrNotSupported
 	}
 	// Create the output PDF and the importer from the base PDF.
-	rdr = bytes.NewReader(bm.Type.PDFBase)
+	rdr = bytes.NewReader(base)
 	pdf = gofpdf.New("P", "pt", "Letter", "")
 	pdf.SetAutoPageBreak(false, 0)
 	pdf.SetMargins(0, 0, 0)
@@ -81,8 +82,8 @@ func (bm *BaseMessage) RenderPDF(_ *envelope.Envelope, filename string) (err err
 		imp.UseImportedTemplate(pdf, tpl, 0, 0, w, h)
 		// Look for fields that need to be written to the page.
 		for _, f := range bm.Fields {
-			if f.PDFRenderer != nil {
-				if err = f.PDFRenderer.RenderToPDF(f, pdf, page); err != nil {
+			if r := bm.Type.FieldPDFRenderer(f); r != nil {
+				if err = r.RenderToPDF(f, pdf, page); err != nil {
 					if !errors.As(err, &warn) {
 						return err
 					}
@@ -91,6 +92,12 @@ func (bm *BaseMessage) RenderPDF(_ *envelope.Envelope, filename string) (err err
 		}
 		page++
 	}
+	// Add the QR codes if requested.
+	if IncludeQRCodes {
+		if err = renderQRCodes(pdf, bm.EncodeBody()); err != nil {
+			return err
+		}
+	}
 	// Write the resulting PDF.
 	if err = pdf.OutputFileAndClose(filename); err != nil {
 		os.Remove(filename)
@@ -0,0 +1,155 @@
+package xscmsg
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rothskeller/packet/message"
+	"github.com/rothskeller/packet/xscmsg/ics213"
+	"github.com/rothskeller/pdf/pdfstruct"
+)
+
+// fillPDFForm fills in a copy of a fillable PDF form, and returns the name of
+// the copy.  text maps the names of text fields to their values.  buttons
+// maps the names of radio button groups to the X coordinate (in PDF space) of
+// the button to turn on.
+func fillPDFForm(t *testing.T, blank string, text map[string]string, buttons map[string]float64) string {
+	var (
+		filled = filepath.Join(t.TempDir(), "filled.pdf")
+		src    *os.File
+		fh     *os.File
+		pdf    *pdfstruct.PDF
+		err    error
+	)
+	if src, err = os.Open(blank); err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if fh, err = os.OpenFile(filled, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	if _, err = io.Copy(fh, src); err != nil {
+		t.Fatal(err)
+	}
+	if pdf, err = pdfstruct.Open(fh); err != nil {
+		t.Fatal(err)
+	}
+	form := resolvePDF(t, pdf, pdf.Catalog["AcroForm"]).(pdfstruct.Dict)
+	for _, fref := range resolvePDF(t, pdf, form["Fields"]).(pdfstruct.Array) {
+		ref := fref.(pdfstruct.Reference)
+		field := resolvePDF(t, pdf, ref).(pdfstruct.Dict)
+		name, _ := field["T"].(string)
+		if value, ok := text[name]; ok {
+			field["V"] = value
+			pdf.UpdateObject(ref, field)
+		}
+		if x, ok := buttons[name]; ok {
+			var on pdfstruct.Name
+			for _, kref := range resolvePDF(t, pdf, field["Kids"]).(pdfstruct.Array) {
+				kid := resolvePDF(t, pdf, kref).(pdfstruct.Dict)
+				rect := resolvePDF(t, pdf, kid["Rect"]).(pdfstruct.Array)
+				ap := resolvePDF(t, pdf, kid["AP"]).(pdfstruct.Dict)
+				state := pdfstruct.Name("Off")
+				if llx := pdfNum(rect[0]); math.Abs(llx-x) < 2 {
+					for key := range resolvePDF(t, pdf, ap["N"]).(pdfstruct.Dict) {
+						if key != "Off" {
+							state, on = key, key
+						}
+					}
+				}
+				kid["AS"] = state
+				pdf.UpdateObject(kref.(pdfstruct.Reference), kid)
+			}
+			if on == "" {
+				t.Fatalf("no button in %q at x=%v", name, x)
+			}
+			field["V"] = on
+			pdf.UpdateObject(ref, field)
+		}
+	}
+	if err = pdf.Write(); err != nil {
+		t.Fatal(err)
+	}
+	return filled
+}
+
+func resolvePDF(t *testing.T, pdf *pdfstruct.PDF, obj pdfstruct.Object) pdfstruct.Object {
+	if ref, ok := obj.(pdfstruct.Reference); ok {
+		var err error
+		if obj, err = pdf.Get(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return obj
+}
+
+func pdfNum(obj pdfstruct.Object) float64 {
+	switch n := obj.(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+func TestImportPDF(t *testing.T) {
+	Register()
+	filled := fillPDFForm(t, filepath.Join("ics213", "ICS-213_SCCo_Message_Form_Fillable_v20220119.pdf"),
+		map[string]string{
+			"Origin Msg #":      "XND-123P",
+			"FormDate":          "3/4/24",
+			"TO ICS Position":   "Planning",
+			"From ICS Position": "Logistics",
+			"Subject":           "Shelter supplies",
+			"Message":           "Need 50 cots\rat the high school.",
+		},
+		map[string]float64{
+			"Immediate":     301, // IMMEDIATE
+			"TakeAction":    417, // Yes
+			"How: Received": 83,  // receiver
+		})
+	fh, err := os.Open(filled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fh.Close()
+	msg, err := message.ImportPDF(fh, "ICS213", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, ok := msg.(*ics213.ICS213v22)
+	if !ok {
+		t.Fatalf("imported %T", msg)
+	}
+	for _, tt := range []struct{ name, got, want string }{
+		{"OriginMsgID", form.OriginMsgID, "XND-123P"},
+		{"Date", form.Date, "03/04/2024"},
+		{"ToICSPosition", form.ToICSPosition, "Planning"},
+		{"FromICSPosition", form.FromICSPosition, "Logistics"},
+		{"Subject", form.Subject, "Shelter supplies"},
+		{"Message", form.Message, "Need 50 cots\nat the high school."},
+		{"Handling", form.Handling, "IMMEDIATE"},
+		{"TakeAction", form.TakeAction, "Yes"},
+		{"Reply", form.Reply, ""},
+		{"ReceivedSent", form.ReceivedSent, "receiver"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+	// Without a type, the form is recognized by its layout.
+	if _, err = fh.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err = message.ImportPDF(fh, "", ""); err != nil && msg == nil {
+		t.Fatal(err)
+	}
+	if msg.Base().Type.Tag != "ICS213" {
+		t.Errorf("recognized as %s", msg.Base().Type.Tag)
+	}
+}
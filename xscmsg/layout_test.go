@@ -0,0 +1,250 @@
+//go:build packetpdf
+
+package xscmsg
+
+// This file contains PDF layout regression tests.  For each registered message
+// type that supports PDF rendering, it renders a synthetic message with every
+// field populated, extracts the positions of the text and marks drawn on the
+// page, and compares them against a golden layout stored in testdata/layout.
+// To regenerate the golden layouts after an intentional layout change, run
+//
+//	go test -tags packetpdf ./xscmsg -update
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rothskeller/gofpdf"
+
+	"github.com/rothskeller/packet/envelope"
+	"github.com/rothskeller/packet/message"
+	"github.com/rothskeller/pdf/pdfstruct"
+)
+
+var updateLayout = flag.Bool("update", false, "rewrite golden PDF layouts")
+
+func TestPDFLayout(t *testing.T) {
+	var tags []string
+	for tag := range message.RegisteredTypes {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	for _, tag := range tags {
+		for _, mtype := range message.RegisteredTypes[tag] {
+			if mtype.PDFTemplate() == nil {
+				continue
+			}
+			msg := message.Create(mtype.Tag, mtype.Version)
+			if msg == nil {
+				continue
+			}
+			t.Run(mtype.Tag+"-"+mtype.Version, func(t *testing.T) {
+				testPDFLayout(t, msg)
+			})
+		}
+	}
+}
+
+func testPDFLayout(t *testing.T, msg message.Message) {
+	var (
+		mtype  = msg.Base().Type
+		golden = filepath.Join("testdata", "layout", mtype.Tag+"-"+mtype.Version+".txt")
+		pfile  = filepath.Join(t.TempDir(), "layout.pdf")
+		warn   message.Warning
+		layout []string
+	)
+	populateForLayout(msg)
+	if err := msg.RenderPDF(new(envelope.Envelope), pfile); err != nil && !errors.As(err, &warn) {
+		t.Fatalf("render: %s", err)
+	}
+	items, npages, err := extractLayout(pfile)
+	if err != nil {
+		t.Fatalf("extract layout: %s", err)
+	}
+	layout = append(fieldWarnings(msg, npages), items...)
+	actual := strings.Join(layout, "\n") + "\n"
+	if *updateLayout {
+		if err = os.MkdirAll(filepath.Dir(golden), 0777); err == nil {
+			err = os.WriteFile(golden, []byte(actual), 0666)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("no golden layout (run with -update to create): %s", err)
+	}
+	if diff := diffLayout(strings.Split(strings.TrimSuffix(string(expected), "\n"), "\n"), layout); diff != "" {
+		t.Errorf("layout differs from %s:\n%s", golden, diff)
+	}
+}
+
+// populateForLayout fills every field of the message with a deterministic
+// value.  Fields with choices get their first choice; other fields get their
+// label, repeated or truncated to the field's edit width, so that a field box
+// that is too small for its advertised width shows up as an overflow.
+func populateForLayout(msg message.Message) {
+	for _, f := range msg.Base().Fields {
+		if f.Value == nil {
+			continue
+		}
+		if f.Choices != nil {
+			if choices := f.Choices.ListHuman(); len(choices) != 0 {
+				*f.Value = f.Choices.ToPIFO(choices[0])
+				continue
+			}
+		}
+		value := f.Label
+		if f.EditWidth > 0 {
+			for len(value) < f.EditWidth {
+				value += " " + f.Label
+			}
+			value = value[:f.EditWidth]
+		}
+		if f.Multiline {
+			value += "\n" + value
+		}
+		*f.Value = value
+	}
+}
+
+// fieldWarnings returns the warnings generated when rendering each field of
+// the message.  RenderPDF itself returns only one of them, which would let a
+// newly overflowing field hide behind one that already overflowed.
+func fieldWarnings(msg message.Message, npages int) (warnings []string) {
+	var (
+		pdf   = gofpdf.New("P", "pt", "Letter", "")
+		mtype = msg.Base().Type
+	)
+
+	for page := 1; page <= npages; page++ {
+		pdf.AddPage()
+		for _, f := range msg.Base().Fields {
+			r := mtype.FieldPDFRenderer(f)
+			if r == nil {
+				continue
+			}
+			if err := r.RenderToPDF(f, pdf, page); err != nil {
+				warnings = append(warnings, fmt.Sprintf("page %d warning %s", page, err))
+			}
+		}
+	}
+	return warnings
+}
+
+var (
+	textOpRE = regexp.MustCompile(`BT ([-\d.]+) ([-\d.]+) Td \(((?:[^\\)]|\\.)*)\) Tj ET`)
+	fontOpRE = regexp.MustCompile(`/\S+ ([\d.]+) Tf`)
+	moveOpRE = regexp.MustCompile(`^([-\d.]+) ([-\d.]+) m$`)
+)
+
+// extractLayout returns a description of the text and marks drawn directly
+// on each page of the PDF.  Content drawn by the imported base form is in a
+// separate XObject, and therefore is not included.
+func extractLayout(pfile string) (items []string, npages int, err error) {
+	var (
+		fh    *os.File
+		pdf   *pdfstruct.PDF
+		pages pdfstruct.Dict
+	)
+	if fh, err = os.Open(pfile); err != nil {
+		return nil, 0, err
+	}
+	defer fh.Close()
+	if pdf, err = pdfstruct.Open(fh); err != nil {
+		return nil, 0, err
+	}
+	if pages, err = pdf.GetDict(pdf.Catalog["Pages"].(pdfstruct.Reference)); err != nil {
+		return nil, 0, err
+	}
+	kids := pages["Kids"].(pdfstruct.Array)
+	for pnum, kid := range kids {
+		var (
+			page     pdfstruct.Dict
+			contents pdfstruct.Stream
+			size     = "?"
+		)
+		if page, err = pdf.GetDict(kid.(pdfstruct.Reference)); err != nil {
+			return nil, 0, err
+		}
+		if contents, err = pdf.GetStream(page["Contents"].(pdfstruct.Reference)); err != nil {
+			return nil, 0, err
+		}
+		if err = contents.Decompress(0); err != nil {
+			return nil, 0, err
+		}
+		for _, line := range strings.Split(string(contents.Data), "\n") {
+			if match := fontOpRE.FindStringSubmatch(line); match != nil {
+				size = match[1]
+			}
+			for _, match := range textOpRE.FindAllStringSubmatch(line, -1) {
+				items = append(items, fmt.Sprintf("page %d text %s %s %s %s",
+					pnum+1, match[1], match[2], size, strconv.Quote(unescapePDF(match[3]))))
+			}
+			if match := moveOpRE.FindStringSubmatch(line); match != nil {
+				items = append(items, fmt.Sprintf("page %d mark %s %s", pnum+1, match[1], match[2]))
+			}
+		}
+	}
+	return items, len(kids), nil
+}
+
+// unescapePDF removes the backslash escapes from a PDF string literal.
+func unescapePDF(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			default:
+				buf.WriteByte(s[i])
+			}
+			continue
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// diffLayout returns a description of the lines that were removed from or
+// added to the expected layout, or an empty string if there are none.
+func diffLayout(expected, actual []string) string {
+	var (
+		sb   strings.Builder
+		seen = make(map[string]int)
+	)
+	for _, line := range actual {
+		seen[line]++
+	}
+	for _, line := range expected {
+		if seen[line] > 0 {
+			seen[line]--
+		} else {
+			fmt.Fprintf(&sb, "- %s\n", line)
+		}
+	}
+	for _, line := range actual {
+		if seen[line] > 0 {
+			seen[line]--
+			fmt.Fprintf(&sb, "+ %s\n", line)
+		}
+	}
+	return sb.String()
+}
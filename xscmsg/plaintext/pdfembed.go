@@ -50,6 +50,13 @@ func renderPDFActual(env *envelope.Envelope, label, lmi, body, filename string)
 		pdf.MultiCell(0, 14.4, env.To, "", "L", false)
 		pdf.Ln(3.6)
 	}
+	if env.Cc != "" {
+		pdf.SetFontStyle("B")
+		pdf.Cell(63, 14.4, "Cc")
+		pdf.SetFontStyle("")
+		pdf.MultiCell(0, 14.4, env.Cc, "", "L", false)
+		pdf.Ln(3.6)
+	}
 	pdf.SetFontStyle("B")
 	pdf.Cell(63, 14.4, "Subject")
 	pdf.SetFontStyle("")